@@ -1,15 +1,14 @@
 package gambler
 
 import (
-	"log"
 	"time"
 )
 
 func MiddlewareA() HandlerFunc {
 	return func(c *Context) {
 		t := time.Now()
-		log.Printf("Debug msg : MiddlewareA.go -> MiddlewareA : START middle ware [ MiddlewareA ]\n")
+		c.Logger().Debug("middleware start", F("middleware", "MiddlewareA"))
 		c.Next()
-		log.Printf("Debug msg : MiddlewareA.go -> MiddlewareA : END middleware [ MiddlewareA ] with msg = [%d] %s in %v\n", c.StatusCode, c.Req.RequestURI, time.Since(t))
+		c.Logger().Debug("middleware end", F("middleware", "MiddlewareA"), F("status", c.StatusCode), F("uri", c.Req.RequestURI), F("latency", time.Since(t)))
 	}
 }
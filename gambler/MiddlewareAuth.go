@@ -0,0 +1,234 @@
+package gambler
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MiddlewareAuth.go: 认证中间件，包括 HTTP Basic 认证、Bearer Token 认证和 API Key 认证
+// 认证通过后把用户(principal)保存到 Context 中，handler 通过 c.Principal() 获取；认证失败时返回 401
+
+// AuthPrincipalKey 认证通过的用户在 Context 中保存的 key
+const AuthPrincipalKey = "gambler/principal"
+
+// Principal 返回认证中间件保存的用户，BasicAuth 保存的是用户名，其他认证方式保存的是 Validator 返回的值
+func (c *Context) Principal() interface{} {
+	principal, _ := c.Get(AuthPrincipalKey)
+	return principal
+}
+
+// BasicAuthConfig Basic 认证的配置
+type BasicAuthConfig struct {
+	Accounts     map[string]string                            // 用户名 -> 密码
+	Validator    func(c *Context, user, password string) bool // 自定义校验，和 Accounts 任意一个通过即可
+	Realm        string                                       // 认证域，默认 Authorization Required
+	Unauthorized HandlerFunc                                  // 认证失败的响应，默认返回 401
+}
+
+// BearerAuthConfig Bearer Token 认证的配置
+type BearerAuthConfig struct {
+	Validator    func(c *Context, token string) (principal interface{}, ok bool) // 校验 token，必须设置
+	Realm        string                                                          // 认证域，默认 Authorization Required
+	Unauthorized HandlerFunc                                                     // 认证失败的响应，默认返回 401
+}
+
+// APIKeyConfig API Key 认证的配置
+type APIKeyConfig struct {
+	// Lookup 从哪里获取 API Key，多个位置用逗号分隔，按顺序查找，默认 header:X-API-Key
+	// eg: "header:X-API-Key,query:api_key,cookie:api_key"
+	Lookup       string
+	Validator    func(c *Context, key string) (principal interface{}, ok bool) // 校验 API Key，必须设置
+	Realm        string                                                        // 认证域，默认 Authorization Required
+	Unauthorized HandlerFunc                                                   // 认证失败的响应，默认返回 401
+}
+
+// MiddlewareBasicAuth 使用用户名和密码进行 Basic 认证
+func MiddlewareBasicAuth(accounts map[string]string) HandlerFunc {
+	return MiddlewareBasicAuthWithConfig(BasicAuthConfig{Accounts: accounts})
+}
+
+// MiddlewareBasicAuthWithConfig 根据配置创建 Basic 认证中间件
+func MiddlewareBasicAuthWithConfig(conf BasicAuthConfig) HandlerFunc {
+	if conf.Realm == "" {
+		conf.Realm = "Authorization Required"
+	}
+	challenge := "Basic realm=" + strconv.Quote(conf.Realm) + `, charset="UTF-8"`
+	if conf.Unauthorized == nil {
+		conf.Unauthorized = unauthorized(challenge)
+	}
+	// 提前计算密码的摘要，比较时长度固定，配合 ConstantTimeCompare 避免时序攻击
+	digests := make(map[string][sha256.Size]byte, len(conf.Accounts))
+	for user, password := range conf.Accounts {
+		digests[user] = sha256.Sum256([]byte(password))
+	}
+	dummy := sha256.Sum256([]byte("gambler"))
+	return func(c *Context) {
+		user, password, ok := c.Req.BasicAuth()
+		if ok {
+			expected, exists := digests[user]
+			if !exists {
+				// 用户不存在时也做一次比较，不暴露用户是否存在
+				expected = dummy
+			}
+			actual := sha256.Sum256([]byte(password))
+			ok = subtle.ConstantTimeCompare(expected[:], actual[:]) == 1 && exists
+			if !ok && conf.Validator != nil {
+				ok = conf.Validator(c, user, password)
+			}
+		}
+		if !ok {
+			c.Abort()
+			conf.Unauthorized(c)
+			return
+		}
+		c.Set(AuthPrincipalKey, user)
+		c.Next()
+	}
+}
+
+// MiddlewareBearerAuth 从 Authorization: Bearer <token> 中获取 token 并校验
+func MiddlewareBearerAuth(validator func(c *Context, token string) (interface{}, bool)) HandlerFunc {
+	return MiddlewareBearerAuthWithConfig(BearerAuthConfig{Validator: validator})
+}
+
+// MiddlewareBearerAuthWithConfig 根据配置创建 Bearer Token 认证中间件
+func MiddlewareBearerAuthWithConfig(conf BearerAuthConfig) HandlerFunc {
+	if conf.Validator == nil {
+		panic("gambler: bearer auth needs a Validator")
+	}
+	if conf.Realm == "" {
+		conf.Realm = "Authorization Required"
+	}
+	realm := "Bearer realm=" + strconv.Quote(conf.Realm)
+	missing, invalid := conf.Unauthorized, conf.Unauthorized
+	if conf.Unauthorized == nil {
+		// 没有带 token 时只返回 realm，带了但是无效时按照 RFC 6750 加上 error="invalid_token"
+		missing = unauthorized(realm)
+		invalid = unauthorized(realm + `, error="invalid_token"`)
+	}
+	return func(c *Context) {
+		token, ok := bearerToken(c.Req)
+		if !ok {
+			c.Abort()
+			missing(c)
+			return
+		}
+		principal, ok := conf.Validator(c, token)
+		if !ok {
+			c.Abort()
+			invalid(c)
+			return
+		}
+		c.Set(AuthPrincipalKey, principal)
+		c.Next()
+	}
+}
+
+// MiddlewareAPIKey 从请求头 X-API-Key 中获取 API Key 并校验
+func MiddlewareAPIKey(validator func(c *Context, key string) (interface{}, bool)) HandlerFunc {
+	return MiddlewareAPIKeyWithConfig(APIKeyConfig{Validator: validator})
+}
+
+// MiddlewareAPIKeyWithConfig 根据配置创建 API Key 认证中间件
+func MiddlewareAPIKeyWithConfig(conf APIKeyConfig) HandlerFunc {
+	if conf.Validator == nil {
+		panic("gambler: api key auth needs a Validator")
+	}
+	if conf.Lookup == "" {
+		conf.Lookup = "header:X-API-Key"
+	}
+	if conf.Realm == "" {
+		conf.Realm = "Authorization Required"
+	}
+	if conf.Unauthorized == nil {
+		// API Key 没有标准的认证方案，使用 APIKey 作为 scheme 告诉客户端需要认证
+		conf.Unauthorized = unauthorized("APIKey realm=" + strconv.Quote(conf.Realm))
+	}
+	extractors := parseLookup(conf.Lookup)
+	return func(c *Context) {
+		for _, extract := range extractors {
+			key := extract(c)
+			if key == "" {
+				continue
+			}
+			if principal, ok := conf.Validator(c, key); ok {
+				c.Set(AuthPrincipalKey, principal)
+				c.Next()
+				return
+			}
+			break
+		}
+		c.Abort()
+		conf.Unauthorized(c)
+	}
+}
+
+// unauthorized 默认的认证失败响应
+func unauthorized(challenge string) HandlerFunc {
+	return func(c *Context) {
+		if challenge != "" {
+			c.SetHeader("WWW-Authenticate", challenge)
+		}
+		c.Fail(http.StatusUnauthorized, "Unauthorized")
+	}
+}
+
+// bearerToken 从 Authorization 请求头中获取 Bearer token
+func bearerToken(req *http.Request) (string, bool) {
+	auth := req.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+	token := strings.TrimSpace(auth[len(prefix):])
+	return token, token != ""
+}
+
+// valueExtractor 从请求中获取一个值，eg: token、API Key
+type valueExtractor func(c *Context) string
+
+// parseLookup 解析 "header:X-API-Key,query:api_key,cookie:api_key" 这样的配置，还支持 form:name 从表单中获取
+func parseLookup(lookup string) []valueExtractor {
+	extractors := make([]valueExtractor, 0)
+	for _, item := range strings.Split(lookup, ",") {
+		source, name, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok || name == "" {
+			panic("gambler: invalid lookup " + item)
+		}
+		switch source {
+		case "header":
+			extractors = append(extractors, func(c *Context) string {
+				value := c.Req.Header.Get(name)
+				// Authorization 请求头支持 "Bearer xxx" 的形式
+				if strings.EqualFold(name, "Authorization") {
+					if token, ok := bearerToken(c.Req); ok {
+						return token
+					}
+				}
+				return value
+			})
+		case "query":
+			extractors = append(extractors, func(c *Context) string {
+				return c.Query(name)
+			})
+		case "form":
+			extractors = append(extractors, func(c *Context) string {
+				return c.PostForm(name)
+			})
+		case "cookie":
+			extractors = append(extractors, func(c *Context) string {
+				cookie, err := c.Req.Cookie(name)
+				if err != nil {
+					return ""
+				}
+				return cookie.Value
+			})
+		default:
+			panic("gambler: invalid lookup source " + source)
+		}
+	}
+	return extractors
+}
@@ -0,0 +1,98 @@
+package gambler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newAuthTestEngine(auth HandlerFunc) *Engine {
+	r := New()
+	r.UseMiddlewares(auth)
+	r.GET("/me", func(c *Context) {
+		c.String(http.StatusOK, "%v", c.Principal())
+	})
+	return r
+}
+
+func TestMiddlewareBasicAuth(t *testing.T) {
+	r := newAuthTestEngine(MiddlewareBasicAuth(map[string]string{"liup2": "secret"}))
+	req := httptest.NewRequest("GET", "/me", nil)
+	req.SetBasicAuth("liup2", "secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "liup2" {
+		t.Fatalf("valid account should pass, got %d %q", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/me", nil)
+	req.SetBasicAuth("liup2", "wrong")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != `Basic realm="Authorization Required", charset="UTF-8"` {
+		t.Fatalf("wrong password should be rejected, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestMiddlewareBearerAuth(t *testing.T) {
+	r := newAuthTestEngine(MiddlewareBearerAuth(func(c *Context, token string) (interface{}, bool) {
+		return "user-" + token, token == "good"
+	}))
+	req := httptest.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer good")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.String() != "user-good" {
+		t.Fatalf("valid token should pass, got %d %q", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer bad")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != `Bearer realm="Authorization Required", error="invalid_token"` {
+		t.Fatalf("invalid token should be rejected, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestMiddlewareAPIKey(t *testing.T) {
+	r := newAuthTestEngine(MiddlewareAPIKeyWithConfig(APIKeyConfig{
+		Lookup: "header:X-API-Key,query:api_key,cookie:api_key",
+		Validator: func(c *Context, key string) (interface{}, bool) {
+			return "service-a", key == "k1"
+		},
+	}))
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/me?api_key=k1", nil),
+		func() *http.Request {
+			req := httptest.NewRequest("GET", "/me", nil)
+			req.AddCookie(&http.Cookie{Name: "api_key", Value: "k1"})
+			return req
+		}(),
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Body.String() != "service-a" {
+			t.Fatalf("valid api key should pass, got %d %q", w.Code, w.Body.String())
+		}
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/me", nil))
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != `APIKey realm="Authorization Required"` {
+		t.Fatalf("missing api key should be challenged, got %d %v", w.Code, w.Header())
+	}
+
+	r = newAuthTestEngine(MiddlewareAPIKeyWithConfig(APIKeyConfig{
+		Realm: "internal",
+		Validator: func(c *Context, key string) (interface{}, bool) {
+			return nil, false
+		},
+	}))
+	req := httptest.NewRequest("GET", "/me", nil)
+	req.Header.Set("X-API-Key", "wrong")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != `APIKey realm="internal"` {
+		t.Fatalf("invalid api key should be challenged with the realm, got %d %v", w.Code, w.Header())
+	}
+}
@@ -1,15 +1,14 @@
 package gambler
 
 import (
-	"log"
 	"time"
 )
 
 func MiddlewareB() HandlerFunc {
 	return func(c *Context) {
 		t := time.Now()
-		log.Printf("Debug msg : MiddlewareB.go -> MiddlewareB : START middle ware [ MiddlewareB ]\n")
+		c.Logger().Debug("middleware start", F("middleware", "MiddlewareB"))
 		c.Next()
-		log.Printf("Debug msg : MiddlewareB.go -> MiddlewareB : END middleware [ MiddlewareB ] with msg = [%d] %s in %v\n", c.StatusCode, c.Req.RequestURI, time.Since(t))
+		c.Logger().Debug("middleware end", F("middleware", "MiddlewareB"), F("status", c.StatusCode), F("uri", c.Req.RequestURI), F("latency", time.Since(t)))
 	}
 }
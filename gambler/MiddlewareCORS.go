@@ -0,0 +1,117 @@
+package gambler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MiddlewareCORS.go: 跨域资源共享中间件
+// 浏览器跨域发送非简单请求前会先发送 OPTIONS 预检请求，这里由中间件直接应答，即使没有注册 OPTIONS 路由也不会 404
+// 因为分组中间件在路由匹配之前就已经加入了 handlers 列表，所以中间件可以先于 404 handler 执行并 Abort
+
+// CORSConfig 跨域中间件的配置
+type CORSConfig struct {
+	AllowOrigins     []string                 // 允许的来源，支持 "*"、完整来源 "https://example.com" 和子域名通配 "https://*.example.com"
+	AllowOriginFunc  func(origin string) bool // 自定义的来源校验，和 AllowOrigins 任意一个通过即可
+	AllowMethods     []string                 // 允许的请求方式，默认 GET POST PUT PATCH DELETE HEAD OPTIONS
+	AllowHeaders     []string                 // 允许的请求头，为空时回显预检请求中的 Access-Control-Request-Headers
+	ExposeHeaders    []string                 // 允许浏览器读取的响应头
+	AllowCredentials bool                     // 是否允许携带 Cookie 等凭证，开启后不会返回 "*"，而是回显具体的来源
+	MaxAge           time.Duration            // 预检结果的缓存时间
+}
+
+// MiddlewareCORS 使用默认配置的跨域中间件，允许所有来源
+func MiddlewareCORS() HandlerFunc {
+	return MiddlewareCORSWithConfig(CORSConfig{AllowOrigins: []string{"*"}})
+}
+
+// MiddlewareCORSWithConfig 根据配置创建跨域中间件
+func MiddlewareCORSWithConfig(conf CORSConfig) HandlerFunc {
+	if len(conf.AllowMethods) == 0 {
+		conf.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+	}
+	allowAll := false
+	exact := make(map[string]bool)
+	var wildcards [][2]string // 子域名通配拆成前缀和后缀，eg: https://*.example.com -> ["https://", ".example.com"]
+	for _, origin := range conf.AllowOrigins {
+		origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+		if origin == "*" {
+			allowAll = true
+		} else if i := strings.Index(origin, "*"); i >= 0 {
+			wildcards = append(wildcards, [2]string{origin[:i], origin[i+1:]})
+		} else {
+			exact[origin] = true
+		}
+	}
+	allowOrigin := func(origin string) bool {
+		lower := strings.ToLower(origin)
+		if allowAll || exact[lower] {
+			return true
+		}
+		for _, w := range wildcards {
+			if len(lower) > len(w[0])+len(w[1]) && strings.HasPrefix(lower, w[0]) && strings.HasSuffix(lower, w[1]) {
+				return true
+			}
+		}
+		return conf.AllowOriginFunc != nil && conf.AllowOriginFunc(origin)
+	}
+	allowMethods := strings.Join(conf.AllowMethods, ", ")
+	allowHeaders := strings.Join(conf.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(conf.ExposeHeaders, ", ")
+	maxAge := ""
+	if conf.MaxAge > 0 {
+		maxAge = strconv.FormatInt(int64(conf.MaxAge/time.Second), 10)
+	}
+
+	return func(c *Context) {
+		origin := c.Req.Header.Get("Origin")
+		header := c.Writer.Header()
+		// 响应内容和 Origin 有关，缓存需要区分
+		header.Add("Vary", "Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		preflight := c.Method == http.MethodOptions && c.Req.Header.Get("Access-Control-Request-Method") != ""
+		if !allowOrigin(origin) {
+			if preflight {
+				c.Abort()
+				c.SetStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+		if allowAll && !conf.AllowCredentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if conf.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if exposeHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			c.Next()
+			return
+		}
+		// 预检请求由中间件直接应答，不再执行后面的 handler
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		header.Set("Access-Control-Allow-Methods", allowMethods)
+		if allowHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", allowHeaders)
+		} else if requested := c.Req.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			header.Set("Access-Control-Allow-Headers", requested)
+		}
+		if maxAge != "" {
+			header.Set("Access-Control-Max-Age", maxAge)
+		}
+		c.Abort()
+		c.SetStatus(http.StatusNoContent)
+	}
+}
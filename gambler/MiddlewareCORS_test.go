@@ -0,0 +1,61 @@
+package gambler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareCORSPreflight(t *testing.T) {
+	r := New()
+	r.UseMiddlewares(MiddlewareCORSWithConfig(CORSConfig{
+		AllowOrigins:     []string{"https://app.example.com", "https://*.example.org"},
+		AllowHeaders:     []string{"Content-Type", "Authorization"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	}))
+	r.POST("/login", func(c *Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	// 没有注册 OPTIONS 路由，预检请求也应该由中间件应答
+	req := httptest.NewRequest("OPTIONS", "/login", nil)
+	req.Header.Set("Origin", "https://api.example.org")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight should return 204, got %d", w.Code)
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://api.example.org" ||
+		w.Header().Get("Access-Control-Allow-Credentials") != "true" ||
+		w.Header().Get("Access-Control-Max-Age") != "3600" {
+		t.Fatalf("unexpected preflight headers: %v", w.Header())
+	}
+
+	// 不允许的来源
+	req = httptest.NewRequest("OPTIONS", "/login", nil)
+	req.Header.Set("Origin", "https://evil.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("origin should be rejected, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestMiddlewareCORSSimpleRequest(t *testing.T) {
+	r := New()
+	r.UseMiddlewares(MiddlewareCORS())
+	r.GET("/hello", func(c *Context) {
+		c.String(http.StatusOK, "hello")
+	})
+	req := httptest.NewRequest("GET", "/hello", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.String() != "hello" || w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Fatalf("unexpected response: %q %v", w.Body.String(), w.Header())
+	}
+}
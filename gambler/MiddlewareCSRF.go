@@ -0,0 +1,411 @@
+package gambler
+
+import (
+	"container/list"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MiddlewareCSRF.go: 跨站请求伪造防护中间件
+// 支持两种模式：
+// 1、双重提交 Cookie：token 保存在 Cookie 中，提交表单或者请求头时需要带上同样的 token
+// 2、同步 token：token 保存在服务端的 CSRFStore 中，按照会话区分，Cookie 中只保存会话 ID
+//    token 只有在渲染 {{ csrfToken }}、{{ csrfField }} 或者调用 CSRFToken 时才保存到 CSRFStore，爬虫和健康检查不会占用 CSRFStore
+//    Cookie 中的会话 ID 不在 CSRFStore 中时不会被沿用，而是下发新的会话 ID
+// GET、HEAD、OPTIONS、TRACE 是安全的请求方式，不校验 token；其他请求方式还会校验 Origin/Referer 是否同源
+// 同源校验需要知道原始请求的协议，反向代理终结 TLS 时需要设置 SSLProxyHeaders，否则 HTTPS 页面提交的请求会被当作跨域拒绝
+// 模板中通过 {{ csrfField }} 输出隐藏的表单字段，{{ csrfToken }} 输出 token，需要先 AddFuncMap(CSRFFuncMap())
+
+// CSRF 的两种模式
+const (
+	CSRFDoubleSubmit = "double-submit"
+	CSRFSynchronizer = "synchronizer"
+)
+
+// csrfStateKey 当前请求的 csrfState 在 Context 中保存的 key
+const csrfStateKey = "gambler/csrf_state"
+
+// CSRF 校验失败的错误
+var (
+	ErrCSRFTokenMissing = errors.New("gambler: csrf token missing")
+	ErrCSRFTokenInvalid = errors.New("gambler: csrf token invalid")
+	ErrCSRFOrigin       = errors.New("gambler: csrf origin not allowed")
+)
+
+// csrfTokenLength token 的字节数
+const csrfTokenLength = 32
+
+// CSRFConfig CSRF 中间件的配置
+type CSRFConfig struct {
+	Mode            string                      // CSRFDoubleSubmit 或者 CSRFSynchronizer，默认 CSRFDoubleSubmit
+	Store           CSRFStore                   // 同步 token 模式下保存 token，默认内存存储
+	SessionKey      func(c *Context) string     // 同步 token 模式下区分会话，为空时由中间件通过 Cookie 下发会话 ID
+	Lookup          string                      // 从哪里获取提交的 token，默认 header:X-CSRF-Token,form:_csrf
+	FieldName       string                      // 表单隐藏字段的名称，默认 _csrf
+	CookieName      string                      // Cookie 名称，默认 _csrf
+	CookiePath      string                      // 默认 /
+	CookieDomain    string                      // Cookie 的域名，默认为空表示当前域名
+	CookieSecure    bool                        // 只在 HTTPS 下发送 Cookie
+	CookieHTTPOnly  bool                        // 双重提交模式下前端 JS 需要读取 Cookie 时不能开启；同步 token 模式下会话 Cookie 总是 HttpOnly
+	CookieSameSite  http.SameSite               // 默认 Lax
+	CookieMaxAge    time.Duration               // 默认 12 小时
+	ExemptPaths     []string                    // 不校验的路径，以 * 结尾表示前缀
+	TrustedOrigins  []string                    // 除了同源之外允许的来源，eg: https://app.example.com
+	SSLProxyHeaders map[string]string           // 反向代理终结 TLS 时用来判断原始请求是 HTTPS 的请求头，eg: {"X-Forwarded-Proto": "https"}
+	ErrorHandler    func(c *Context, err error) // 校验失败的响应，默认返回 403
+}
+
+// CSRFStore 同步 token 模式下保存每个会话的 token
+type CSRFStore interface {
+	Get(session string) (token []byte, ok bool)
+	Set(session string, token []byte, expire time.Duration)
+}
+
+// CSRFFuncMap 返回 csrfToken 和 csrfField 模板函数的占位实现，需要在 LoadHTMLGlob 之前通过 AddFuncMap 注册
+// 真正的实现由中间件在每个请求中通过 SetTemplateFunc 设置
+func CSRFFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"csrfToken": func() string { return "" },
+		"csrfField": func() template.HTML { return "" },
+	}
+}
+
+// CSRFToken 返回当前请求的 token，每个请求都经过随机掩码，防止 BREACH 攻击，没有使用 CSRF 中间件时返回空字符串
+func (c *Context) CSRFToken() string {
+	state, ok := c.Get(csrfStateKey)
+	if !ok {
+		return ""
+	}
+	return state.(*csrfState).maskedToken()
+}
+
+// MiddlewareCSRF 使用默认配置的 CSRF 中间件
+func MiddlewareCSRF() HandlerFunc {
+	return MiddlewareCSRFWithConfig(CSRFConfig{})
+}
+
+// MiddlewareCSRFWithConfig 根据配置创建 CSRF 中间件
+func MiddlewareCSRFWithConfig(conf CSRFConfig) HandlerFunc {
+	if conf.Mode == "" {
+		conf.Mode = CSRFDoubleSubmit
+	}
+	if conf.Mode != CSRFDoubleSubmit && conf.Mode != CSRFSynchronizer {
+		panic("gambler: unknown csrf mode " + conf.Mode)
+	}
+	if conf.FieldName == "" {
+		conf.FieldName = "_csrf"
+	}
+	if conf.Lookup == "" {
+		conf.Lookup = "header:X-CSRF-Token,form:" + conf.FieldName
+	}
+	if conf.CookieName == "" {
+		conf.CookieName = "_csrf"
+	}
+	if conf.CookiePath == "" {
+		conf.CookiePath = "/"
+	}
+	if conf.CookieSameSite == 0 {
+		conf.CookieSameSite = http.SameSiteLaxMode
+	}
+	if conf.CookieMaxAge == 0 {
+		conf.CookieMaxAge = 12 * time.Hour
+	}
+	if conf.Mode == CSRFSynchronizer && conf.Store == nil {
+		conf.Store = NewMemoryCSRFStore()
+	}
+	if conf.ErrorHandler == nil {
+		conf.ErrorHandler = func(c *Context, err error) {
+			c.Fail(http.StatusForbidden, "Forbidden")
+		}
+	}
+	trusted := make(map[string]bool, len(conf.TrustedOrigins))
+	for _, origin := range conf.TrustedOrigins {
+		trusted[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+	extractors := parseLookup(conf.Lookup)
+
+	return func(c *Context) {
+		state := conf.newState(c)
+		token := state.token
+		c.Set(csrfStateKey, state)
+		// 模板函数只持有 state，不持有 Context，可以在其他 goroutine 中渲染(eg: 超时中间件)
+		c.SetTemplateFunc("csrfToken", state.maskedToken)
+		c.SetTemplateFunc("csrfField", func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(conf.FieldName) +
+				`" value="` + template.HTMLEscapeString(state.maskedToken()) + `">`)
+		})
+		// 响应中包含 token，不能被共享缓存
+		addVary(c.Writer.Header(), "Cookie")
+
+		switch c.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			c.Next()
+			return
+		}
+		if conf.exempt(c.Path) {
+			c.Next()
+			return
+		}
+		if err := checkCSRFOrigin(c.Req, isHTTPSRequest(c.Req, conf.SSLProxyHeaders), trusted); err != nil {
+			c.Abort()
+			conf.ErrorHandler(c, err)
+			return
+		}
+		var submitted string
+		for _, extract := range extractors {
+			if submitted = extract(c); submitted != "" {
+				break
+			}
+		}
+		if submitted == "" {
+			c.Abort()
+			conf.ErrorHandler(c, ErrCSRFTokenMissing)
+			return
+		}
+		actual := unmaskCSRFToken(submitted)
+		if actual == nil || subtle.ConstantTimeCompare(actual, token) != 1 {
+			c.Abort()
+			conf.ErrorHandler(c, ErrCSRFTokenInvalid)
+			return
+		}
+		c.Next()
+	}
+}
+
+// csrfState 一个请求的 token，同步 token 模式下新的 token 在第一次使用时才保存到 CSRFStore
+type csrfState struct {
+	conf    *CSRFConfig
+	token   []byte
+	session string // 需要保存 token 的会话 ID，为空表示 token 已经保存过或者没有会话
+	once    sync.Once
+	masked  string
+}
+
+// maskedToken 返回掩码后的 token，第一次调用时保存新的 token
+func (s *csrfState) maskedToken() string {
+	s.once.Do(func() {
+		if s.session != "" {
+			s.conf.Store.Set(s.session, s.token, s.conf.CookieMaxAge)
+		}
+		s.masked = maskCSRFToken(s.token)
+	})
+	return s.masked
+}
+
+// newState 读取已有的 token，没有时生成新的 token
+// 双重提交模式下新的 token 直接写到 Cookie 中；同步 token 模式下会话 ID 不在 CSRFStore 中时下发新的会话 ID
+func (conf *CSRFConfig) newState(c *Context) *csrfState {
+	state := &csrfState{conf: conf}
+	if conf.Mode == CSRFDoubleSubmit {
+		if cookie, err := c.Req.Cookie(conf.CookieName); err == nil {
+			token, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+			if err == nil && len(token) == csrfTokenLength {
+				state.token = token
+				return state
+			}
+		}
+		state.token = randomBytes(csrfTokenLength)
+		conf.setCookie(c, base64.RawURLEncoding.EncodeToString(state.token), conf.CookieHTTPOnly)
+		return state
+	}
+
+	var session string
+	if conf.SessionKey != nil {
+		// 应用自己管理的会话，会话 ID 由应用保证不可伪造
+		session = conf.SessionKey(c)
+	} else if cookie, err := c.Req.Cookie(conf.CookieName); err == nil {
+		session = cookie.Value
+	}
+	if session != "" {
+		if token, ok := conf.Store.Get(session); ok {
+			state.token = token
+			return state
+		}
+	}
+	if conf.SessionKey == nil {
+		// 不沿用客户端提交的未知会话 ID，新的 Cookie 只是一个随机数，不占用服务端的存储
+		session = base64.RawURLEncoding.EncodeToString(randomBytes(csrfTokenLength))
+		conf.setCookie(c, session, true)
+	}
+	state.token = randomBytes(csrfTokenLength)
+	state.session = session
+	return state
+}
+
+func (conf *CSRFConfig) setCookie(c *Context, value string, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     conf.CookieName,
+		Value:    value,
+		Path:     conf.CookiePath,
+		Domain:   conf.CookieDomain,
+		MaxAge:   int(conf.CookieMaxAge / time.Second),
+		Secure:   conf.CookieSecure,
+		HttpOnly: httpOnly,
+		SameSite: conf.CookieSameSite,
+	})
+}
+
+// exempt 判断路径是否不需要校验
+func (conf *CSRFConfig) exempt(path string) bool {
+	for _, p := range conf.ExemptPaths {
+		if strings.HasSuffix(p, "*") && strings.HasPrefix(path, p[:len(p)-1]) || path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCSRFOrigin 校验 Origin，没有 Origin 时校验 Referer；HTTPS 请求两者都没有时拒绝
+// https 表示原始请求是否是 HTTPS，协议和 Host 都相同才是同源
+func checkCSRFOrigin(req *http.Request, https bool, trusted map[string]bool) error {
+	scheme := "http"
+	if https {
+		scheme = "https"
+	}
+	self := scheme + "://" + strings.ToLower(req.Host)
+	source := req.Header.Get("Origin")
+	if source == "" || source == "null" {
+		referer := req.Header.Get("Referer")
+		if referer == "" {
+			if https {
+				return ErrCSRFOrigin
+			}
+			return nil
+		}
+		u, err := url.Parse(referer)
+		if err != nil || u.Host == "" {
+			return ErrCSRFOrigin
+		}
+		source = u.Scheme + "://" + u.Host
+	}
+	source = strings.ToLower(source)
+	if source == self || trusted[source] {
+		return nil
+	}
+	return ErrCSRFOrigin
+}
+
+// maskCSRFToken 用随机的 pad 对 token 异或，输出 base64(pad || pad^token)，每次输出都不同
+func maskCSRFToken(token []byte) string {
+	pad := randomBytes(len(token))
+	masked := make([]byte, 2*len(token))
+	copy(masked, pad)
+	for i := range token {
+		masked[len(token)+i] = pad[i] ^ token[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// unmaskCSRFToken 还原 maskCSRFToken 的结果，也接受双重提交模式下前端直接从 Cookie 中读取的原始 token
+func unmaskCSRFToken(masked string) []byte {
+	data, err := base64.RawURLEncoding.DecodeString(masked)
+	if err == nil && len(data) == csrfTokenLength {
+		return data
+	}
+	if err != nil || len(data) != 2*csrfTokenLength {
+		return nil
+	}
+	token := make([]byte, csrfTokenLength)
+	for i := range token {
+		token[i] = data[i] ^ data[csrfTokenLength+i]
+	}
+	return token
+}
+
+// randomBytes 生成随机字节
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// defaultCSRFStoreSize 内存 CSRFStore 默认最多保存的会话数
+const defaultCSRFStoreSize = 100000
+
+// MemoryCSRFStore 基于内存的 CSRFStore，只适用于单实例部署
+// 最多保存固定数量的会话，超过时淘汰最久没有使用的会话，被淘汰的会话再提交表单时会校验失败
+type MemoryCSRFStore struct {
+	mu      sync.Mutex
+	size    int
+	tokens  map[string]*list.Element
+	recency *list.List // 按最近使用排序，最前面的是最近使用的
+}
+
+type csrfEntry struct {
+	session string
+	token   []byte
+	expire  time.Time
+}
+
+// NewMemoryCSRFStore 创建内存 CSRFStore，最多保存 100000 个会话
+func NewMemoryCSRFStore() *MemoryCSRFStore {
+	return NewMemoryCSRFStoreWithSize(defaultCSRFStoreSize)
+}
+
+// NewMemoryCSRFStoreWithSize 创建最多保存 size 个会话的内存 CSRFStore
+func NewMemoryCSRFStoreWithSize(size int) *MemoryCSRFStore {
+	if size <= 0 {
+		panic("gambler: csrf store size must be positive")
+	}
+	return &MemoryCSRFStore{size: size, tokens: make(map[string]*list.Element), recency: list.New()}
+}
+
+// Get 获取会话的 token，过期后返回 false
+func (s *MemoryCSRFStore) Get(session string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem, ok := s.tokens[session]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*csrfEntry)
+	if time.Now().After(entry.expire) {
+		s.remove(elem)
+		return nil, false
+	}
+	s.recency.MoveToFront(elem)
+	return entry.token, true
+}
+
+// Set 保存会话的 token，超过容量时淘汰最久没有使用的会话，只检查最后面的会话，不会遍历所有的会话
+func (s *MemoryCSRFStore) Set(session string, token []byte, expire time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if elem, ok := s.tokens[session]; ok {
+		entry := elem.Value.(*csrfEntry)
+		entry.token, entry.expire = token, now.Add(expire)
+		s.recency.MoveToFront(elem)
+		return
+	}
+	s.tokens[session] = s.recency.PushFront(&csrfEntry{session: session, token: token, expire: now.Add(expire)})
+	for s.recency.Len() > s.size {
+		s.remove(s.recency.Back())
+	}
+	// 顺便清理最后面已经过期的会话
+	for back := s.recency.Back(); back != nil && now.After(back.Value.(*csrfEntry).expire); back = s.recency.Back() {
+		s.remove(back)
+	}
+}
+
+// Len 返回保存的会话数，包括还没有被清理的过期会话
+func (s *MemoryCSRFStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.recency.Len()
+}
+
+func (s *MemoryCSRFStore) remove(elem *list.Element) {
+	s.recency.Remove(elem)
+	delete(s.tokens, elem.Value.(*csrfEntry).session)
+}
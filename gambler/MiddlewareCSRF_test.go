@@ -0,0 +1,158 @@
+package gambler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCSRFTestEngine(t *testing.T, conf CSRFConfig) *Engine {
+	dir := t.TempDir()
+	form := `<form method="post" action="/login">{{ csrfField }}</form>`
+	if err := os.WriteFile(filepath.Join(dir, "form.tmpl"), []byte(form), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r := New()
+	r.SetFuncMap(CSRFFuncMap())
+	r.LoadHTMLGlob(filepath.Join(dir, "*"))
+	r.UseMiddlewares(MiddlewareCSRFWithConfig(conf))
+	r.GET("/form", func(c *Context) {
+		c.HTML(http.StatusOK, "form.tmpl", nil)
+	})
+	r.POST("/login", func(c *Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	return r
+}
+
+// csrfRoundTrip 先 GET 表单拿到 Cookie 和 token，再带上它们 POST
+func csrfRoundTrip(t *testing.T, r *Engine, token func(string) string, origin string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/form", nil))
+	match := regexp.MustCompile(`name="_csrf" value="([^"]+)"`).FindStringSubmatch(w.Body.String())
+	if match == nil {
+		t.Fatalf("form should contain csrf field, got %s", w.Body.String())
+	}
+	form := url.Values{"_csrf": {token(match[1])}}
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddlewareCSRF(t *testing.T) {
+	for _, mode := range []string{CSRFDoubleSubmit, CSRFSynchronizer} {
+		r := newCSRFTestEngine(t, CSRFConfig{Mode: mode})
+		keep := func(token string) string { return token }
+		if w := csrfRoundTrip(t, r, keep, "http://example.com"); w.Code != http.StatusOK {
+			t.Fatalf("%s: valid token should pass, got %d", mode, w.Code)
+		}
+		if w := csrfRoundTrip(t, r, func(string) string { return "" }, ""); w.Code != http.StatusForbidden {
+			t.Fatalf("%s: missing token should be rejected, got %d", mode, w.Code)
+		}
+		if w := csrfRoundTrip(t, r, func(string) string { return maskCSRFToken(randomBytes(csrfTokenLength)) }, ""); w.Code != http.StatusForbidden {
+			t.Fatalf("%s: wrong token should be rejected, got %d", mode, w.Code)
+		}
+		if w := csrfRoundTrip(t, r, keep, "https://evil.com"); w.Code != http.StatusForbidden {
+			t.Fatalf("%s: cross origin request should be rejected, got %d", mode, w.Code)
+		}
+	}
+}
+
+func TestMiddlewareCSRFExempt(t *testing.T) {
+	r := newCSRFTestEngine(t, CSRFConfig{ExemptPaths: []string{"/log*"}})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/login", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("exempt path should pass, got %d", w.Code)
+	}
+}
+
+func TestMiddlewareCSRFBehindProxy(t *testing.T) {
+	proxyHeaders := map[string]string{"X-Forwarded-Proto": "https"}
+	for _, tc := range []struct {
+		headers map[string]string
+		origin  string
+		want    bool
+	}{
+		{nil, "https://example.com", false},
+		{proxyHeaders, "https://example.com", true},
+		{proxyHeaders, "http://example.com", false},
+		{proxyHeaders, "", false},
+	} {
+		req := httptest.NewRequest("POST", "/login", nil)
+		req.Header.Set("X-Forwarded-Proto", "https")
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		err := checkCSRFOrigin(req, isHTTPSRequest(req, tc.headers), nil)
+		if (err == nil) != tc.want {
+			t.Fatalf("headers %v origin %q: want pass=%v, got %v", tc.headers, tc.origin, tc.want, err)
+		}
+	}
+}
+
+func TestMiddlewareCSRFLazySession(t *testing.T) {
+	store := NewMemoryCSRFStore()
+	r := newCSRFTestEngine(t, CSRFConfig{Mode: CSRFSynchronizer, Store: store})
+	r.GET("/healthz", func(c *Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	for i := 0; i < 100; i++ {
+		req := httptest.NewRequest("GET", "/healthz", nil)
+		if i%2 == 0 {
+			req.AddCookie(&http.Cookie{Name: "_csrf", Value: "random-" + strings.Repeat("x", i)})
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if store.Len() != 0 {
+		t.Fatalf("requests without the token should not grow the store, got %d", store.Len())
+	}
+
+	// 不在 CSRFStore 中的会话 ID 不会被沿用
+	req := httptest.NewRequest("GET", "/form", nil)
+	req.AddCookie(&http.Cookie{Name: "_csrf", Value: "attacker-chosen"})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if _, ok := store.Get("attacker-chosen"); ok || store.Len() != 1 {
+		t.Fatalf("unknown session should not be adopted, store has %d", store.Len())
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value == "attacker-chosen" {
+		t.Fatalf("a new session should be issued, got %v", cookies)
+	}
+	if _, ok := store.Get(cookies[0].Value); !ok {
+		t.Fatal("rendered token should be saved for the new session")
+	}
+}
+
+func TestMemoryCSRFStoreSize(t *testing.T) {
+	store := NewMemoryCSRFStoreWithSize(2)
+	store.Set("a", []byte("1"), time.Hour)
+	store.Set("b", []byte("2"), time.Hour)
+	store.Get("a")
+	store.Set("c", []byte("3"), time.Hour)
+	if _, ok := store.Get("b"); ok || store.Len() != 2 {
+		t.Fatalf("least recently used session should be evicted, got %d", store.Len())
+	}
+	if _, ok := store.Get("a"); !ok {
+		t.Fatal("recently used session should be kept")
+	}
+	store.Set("d", []byte("4"), -time.Second)
+	if _, ok := store.Get("d"); ok {
+		t.Fatal("expired session should not be returned")
+	}
+}
@@ -0,0 +1,387 @@
+package gambler
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MiddlewareCompress.go: 响应压缩中间件，根据请求头 Accept-Encoding 协商压缩算法并包装 Context.Writer
+// 内置的只有 gzip 和 deflate，框架不自带 brotli 和 zstd：标准库没有这两种算法的实现，框架也不引入第三方依赖
+// 客户端只接受 br 或者 zstd 时响应不会被压缩；需要时通过 Compressor 接入第三方实现，eg: github.com/andybalholm/brotli
+//
+//	br := gambler.Compressor{Encoding: "br", NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+//		return brotli.NewWriterLevel(w, brotli.DefaultCompression), nil
+//	}}
+//	r.UseMiddlewares(gambler.MiddlewareCompressWithConfig(gambler.CompressConfig{
+//		Compressors: []gambler.Compressor{br, gambler.GzipCompressor, gambler.DeflateCompressor},
+//	}))
+// 响应体小于 MinLength 时不压缩，所以会先缓存一部分数据，等数据足够或者 handler 执行结束后再决定是否压缩
+
+// Compressor 一种压缩算法
+type Compressor struct {
+	Encoding string // Content-Encoding 的值，eg: gzip br zstd
+	// NewWriter 创建压缩 writer，如果返回的 writer 实现了 Reset(io.Writer) 就会被复用
+	// 实现了 Flush() error 的 writer 可以用于 SSE 等流式响应
+	NewWriter func(w io.Writer, level int) (io.WriteCloser, error)
+}
+
+// CompressConfig 压缩中间件的配置
+type CompressConfig struct {
+	Level              int          // 压缩级别，默认 gzip.DefaultCompression
+	MinLength          int          // 小于这个长度的响应体不压缩，默认 1024
+	Compressors        []Compressor // 支持的压缩算法，排在前面的优先，默认 gzip、deflate，不包含 br 和 zstd
+	ExcludedPaths      []string     // 不压缩的路径前缀
+	ExcludedExtensions []string     // 不压缩的文件扩展名，eg: .png
+	ExcludedTypes      []string     // 不压缩的 Content-Type，默认是图片、音视频、压缩包等已经压缩过的类型，以 / 结尾表示前缀
+}
+
+// GzipCompressor 标准库的 gzip
+var GzipCompressor = Compressor{
+	Encoding: "gzip",
+	NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, level)
+	},
+}
+
+// DeflateCompressor 标准库的 deflate
+var DeflateCompressor = Compressor{
+	Encoding: "deflate",
+	NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+		return flate.NewWriter(w, level)
+	},
+}
+
+// 默认不压缩的 Content-Type
+var defaultExcludedTypes = []string{
+	"image/", "video/", "audio/", "font/woff", "font/woff2",
+	"application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+	"application/x-brotli", "application/x-7z-compressed", "application/x-rar-compressed",
+	"application/pdf", "application/octet-stream",
+}
+
+// compressSettings 处理过默认值的配置，所有请求共享
+type compressSettings struct {
+	level         int
+	minLength     int
+	compressors   []Compressor
+	pools         []*sync.Pool
+	excludedPaths []string
+	excludedExts  map[string]bool
+	excludedTypes []string
+}
+
+// MiddlewareCompress 使用默认配置的压缩中间件
+func MiddlewareCompress() HandlerFunc {
+	return MiddlewareCompressWithConfig(CompressConfig{})
+}
+
+// MiddlewareCompressWithConfig 根据配置创建压缩中间件
+func MiddlewareCompressWithConfig(conf CompressConfig) HandlerFunc {
+	s := &compressSettings{
+		level:         conf.Level,
+		minLength:     conf.MinLength,
+		compressors:   conf.Compressors,
+		excludedPaths: conf.ExcludedPaths,
+		excludedExts:  make(map[string]bool),
+		excludedTypes: conf.ExcludedTypes,
+	}
+	if s.level == 0 {
+		s.level = gzip.DefaultCompression
+	}
+	if s.minLength <= 0 {
+		s.minLength = 1024
+	}
+	if len(s.compressors) == 0 {
+		s.compressors = []Compressor{GzipCompressor, DeflateCompressor}
+	}
+	for _, compressor := range s.compressors {
+		if compressor.Encoding == "" || compressor.NewWriter == nil {
+			panic("gambler: compressor needs Encoding and NewWriter")
+		}
+	}
+	if s.excludedTypes == nil {
+		s.excludedTypes = defaultExcludedTypes
+	}
+	for _, ext := range conf.ExcludedExtensions {
+		s.excludedExts[strings.ToLower(ext)] = true
+	}
+	s.pools = make([]*sync.Pool, len(s.compressors))
+	for i := range s.compressors {
+		s.pools[i] = &sync.Pool{}
+	}
+
+	return func(c *Context) {
+		if s.excluded(c.Path) {
+			c.Next()
+			return
+		}
+		// 不管是否压缩，响应内容都和 Accept-Encoding 有关
+		addVary(c.Writer.Header(), "Accept-Encoding")
+		index := s.negotiate(c.Req.Header.Get("Accept-Encoding"))
+		if index < 0 || c.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		cw := &compressWriter{ResponseWriter: c.Writer, settings: s, index: index}
+		c.Writer = cw
+		defer func() {
+			c.Writer = cw.ResponseWriter
+			if err := recover(); err != nil {
+				// handler panic 时丢弃缓存的响应体，不能写出 200，交给外层的 MiddlewareRecover 返回 500
+				cw.buf = nil
+				panic(err)
+			}
+			cw.close()
+		}()
+		c.Next()
+	}
+}
+
+// excluded 判断路径是否不需要压缩
+func (s *compressSettings) excluded(urlPath string) bool {
+	for _, prefix := range s.excludedPaths {
+		if strings.HasPrefix(urlPath, prefix) {
+			return true
+		}
+	}
+	return s.excludedExts[strings.ToLower(path.Ext(urlPath))]
+}
+
+// excludedType 判断 Content-Type 是否已经是压缩过的类型
+func (s *compressSettings) excludedType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	if mediaType == "image/svg+xml" {
+		return false
+	}
+	for _, t := range s.excludedTypes {
+		if strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t) || mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate 解析 Accept-Encoding，返回选中的压缩算法的下标，没有可用的算法时返回 -1
+// eg: Accept-Encoding: gzip;q=0.8, br, *;q=0.1
+func (s *compressSettings) negotiate(acceptEncoding string) int {
+	if acceptEncoding == "" {
+		return -1
+	}
+	best, bestQ := -1, 0.0
+	wildcard := -1.0
+	qs := make(map[string]float64)
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			if parsed, err := strconv.ParseFloat(params[2:], 64); err == nil {
+				q = parsed
+			}
+		}
+		if name == "*" {
+			wildcard = q
+		} else {
+			qs[name] = q
+		}
+	}
+	for i, compressor := range s.compressors {
+		q, ok := qs[compressor.Encoding]
+		if !ok {
+			q = wildcard
+		}
+		// q 相同时按照 compressors 的顺序，排在前面的优先
+		if q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+	return best
+}
+
+// addVary 添加 Vary 响应头，已经存在时不重复添加
+func addVary(header http.Header, value string) {
+	for _, v := range header.Values("Vary") {
+		for _, item := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), value) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", value)
+}
+
+// compressWriter 包装 Context.Writer，根据响应的状态码、Content-Type 和长度决定是否压缩
+type compressWriter struct {
+	http.ResponseWriter
+	settings *compressSettings
+	index    int            // 协商得到的压缩算法
+	encoder  io.WriteCloser // 开始压缩后才创建
+	buf      []byte         // 还没决定是否压缩时缓存的响应体
+	status   int            // handler 设置的状态码，决定是否压缩后才真正写出
+	decided  bool           // 是否已经决定了压缩还是原样输出
+	compress bool
+}
+
+// WriteHeader 只记录状态码，等决定了是否压缩后再写出
+func (w *compressWriter) WriteHeader(code int) {
+	if code < 200 {
+		// 1xx 的信息响应直接写出
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		if w.header().Get("Content-Type") == "" {
+			// net/http 会根据内容推断 Content-Type，压缩后就推断不出来了，所以提前设置
+			w.header().Set("Content-Type", http.DetectContentType(append(w.buf, data...)))
+		}
+		if !w.eligible() {
+			w.start(false)
+		} else {
+			w.buf = append(w.buf, data...)
+			if len(w.buf) < w.settings.minLength {
+				return len(data), nil
+			}
+			if err := w.start(true); err != nil {
+				return 0, err
+			}
+			return len(data), nil
+		}
+	}
+	if w.compress {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressWriter) header() http.Header {
+	return w.ResponseWriter.Header()
+}
+
+// eligible 根据状态码和响应头判断这个响应是否可以压缩
+func (w *compressWriter) eligible() bool {
+	switch w.status {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+	header := w.header()
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	return !w.settings.excludedType(header.Get("Content-Type"))
+}
+
+// start 决定是否压缩，写出响应头和缓存的数据
+func (w *compressWriter) start(compress bool) error {
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if compress {
+		compressor := w.settings.compressors[w.index]
+		pool := w.settings.pools[w.index]
+		if encoder, ok := pool.Get().(io.WriteCloser); ok {
+			encoder.(interface{ Reset(io.Writer) }).Reset(w.ResponseWriter)
+			w.encoder = encoder
+		} else {
+			encoder, err := compressor.NewWriter(w.ResponseWriter, w.settings.level)
+			if err != nil {
+				// 创建失败时退回不压缩
+				compress = false
+			} else {
+				w.encoder = encoder
+			}
+		}
+	}
+	w.compress = compress
+	if compress {
+		w.header().Del("Content-Length")
+		w.header().Set("Content-Encoding", w.settings.compressors[w.index].Encoding)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	var err error
+	if compress {
+		_, err = w.encoder.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush 用于 SSE 等流式响应，刷新时如果还没决定，就不再等待 MinLength 直接开始压缩
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.start(w.eligible())
+	}
+	if w.compress {
+		if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+			flusher.Flush()
+		}
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack 接管连接后不再压缩
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("gambler: ResponseWriter does not implement http.Hijacker")
+	}
+	w.decided = true
+	return hijacker.Hijack()
+}
+
+// Unwrap 供 http.ResponseController 找到原始的 ResponseWriter
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close handler 执行结束后调用，数据不足 MinLength 时原样输出，否则结束压缩流并回收 encoder
+func (w *compressWriter) close() {
+	if !w.decided {
+		if w.status == 0 && len(w.buf) == 0 {
+			// handler 没有写任何响应
+			w.decided = true
+			return
+		}
+		w.start(false)
+	}
+	if w.compress {
+		w.encoder.Close()
+		if _, ok := w.encoder.(interface{ Reset(io.Writer) }); ok {
+			w.settings.pools[w.index].Put(w.encoder)
+		}
+		w.encoder = nil
+	}
+}
@@ -0,0 +1,491 @@
+package gambler
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // 注册 crypto.SHA256
+	_ "crypto/sha512" // 注册 crypto.SHA384 和 crypto.SHA512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MiddlewareJWT.go: JWT 认证中间件
+// 从请求头、Cookie 或者查询参数中获取 token，校验签名和 exp/nbf/iss/aud，通过后把 claims 保存到 Context 中
+// 支持 HS256/384/512、RS256/384/512、ES256/384/512 和 EdDSA，密钥可以直接配置，也可以从磁盘上的 JWKS 文件加载
+
+// JWTClaimsKey JWT claims 在 Context 中保存的 key
+const JWTClaimsKey = "gambler/jwt_claims"
+
+// JWT 校验失败的错误
+var (
+	ErrJWTMalformed        = errors.New("gambler: jwt malformed")
+	ErrJWTUnsupportedAlg   = errors.New("gambler: jwt algorithm not allowed")
+	ErrJWTKeyNotFound      = errors.New("gambler: jwt key not found")
+	ErrJWTInvalidSignature = errors.New("gambler: jwt signature invalid")
+	ErrJWTExpired          = errors.New("gambler: jwt expired")
+	ErrJWTNotValidYet      = errors.New("gambler: jwt not valid yet")
+	ErrJWTInvalidIssuer    = errors.New("gambler: jwt issuer invalid")
+	ErrJWTInvalidAudience  = errors.New("gambler: jwt audience invalid")
+)
+
+// JWTClaims 标准 claims，其他自定义的 claims 可以通过 Decode 解析到自己的结构体中
+type JWTClaims struct {
+	Issuer    string   // iss
+	Subject   string   // sub
+	Audience  []string // aud，可能是字符串也可能是数组，统一转换成数组
+	ExpiresAt int64    // exp，Unix 秒，0 表示没有设置
+	NotBefore int64    // nbf
+	IssuedAt  int64    // iat
+	ID        string   // jti
+	payload   []byte   // 原始的 payload JSON
+}
+
+// Decode 把 payload 解析到自定义的结构体中，eg: claims.Decode(&MyClaims{})
+func (claims *JWTClaims) Decode(v interface{}) error {
+	return json.Unmarshal(claims.payload, v)
+}
+
+// JWTClaims 返回 MiddlewareJWT 保存的 claims，没有通过 JWT 认证时返回 nil
+func (c *Context) JWTClaims() *JWTClaims {
+	value, _ := c.Get(JWTClaimsKey)
+	claims, _ := value.(*JWTClaims)
+	return claims
+}
+
+// JWTConfig JWT 中间件的配置
+type JWTConfig struct {
+	// Lookup 从哪里获取 token，格式和 APIKeyConfig.Lookup 相同，默认 header:Authorization(Bearer xxx)
+	Lookup string
+	// Key 静态密钥：HS 算法使用 []byte，RS 算法使用 *rsa.PublicKey，ES 算法使用 *ecdsa.PublicKey，EdDSA 使用 ed25519.PublicKey
+	Key interface{}
+	// Keys 按照 kid 查找密钥，和 Key 一样可以使用上面的类型
+	Keys map[string]interface{}
+	// JWKSFile 从磁盘加载 JWKS 文档，其中的密钥会合并到 Keys 中
+	JWKSFile string
+	// Algorithms 允许的签名算法，默认是密钥类型对应的所有算法，永远不允许 none
+	Algorithms []string
+	Issuer     string        // 设置后校验 iss
+	Audience   string        // 设置后校验 aud 中包含这个值
+	ClockSkew  time.Duration // 校验 exp 和 nbf 时允许的时钟误差
+	// Unauthorized 认证失败的响应，默认返回 401
+	Unauthorized func(c *Context, err error)
+}
+
+// MiddlewareJWT 根据配置创建 JWT 中间件，配置错误(eg: JWKS 文件不存在)时 panic
+func MiddlewareJWT(conf JWTConfig) HandlerFunc {
+	verifier, err := NewJWTVerifier(conf)
+	if err != nil {
+		panic(err)
+	}
+	if conf.Lookup == "" {
+		conf.Lookup = "header:Authorization"
+	}
+	if conf.Unauthorized == nil {
+		conf.Unauthorized = func(c *Context, err error) {
+			c.SetHeader("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.Fail(http.StatusUnauthorized, "Unauthorized")
+		}
+	}
+	extractors := parseLookup(conf.Lookup)
+	return func(c *Context) {
+		var token string
+		for _, extract := range extractors {
+			if token = extract(c); token != "" {
+				break
+			}
+		}
+		if token == "" {
+			c.Abort()
+			conf.Unauthorized(c, ErrJWTMalformed)
+			return
+		}
+		claims, err := verifier.Verify(token)
+		if err != nil {
+			c.Logger().Debug("jwt rejected", F("error", err))
+			c.Abort()
+			conf.Unauthorized(c, err)
+			return
+		}
+		c.Set(JWTClaimsKey, claims)
+		c.Set(AuthPrincipalKey, claims.Subject)
+		c.Next()
+	}
+}
+
+// JWTVerifier 校验 JWT，可以在中间件之外单独使用
+type JWTVerifier struct {
+	conf       JWTConfig
+	algorithms map[string]bool
+	mu         sync.RWMutex
+	keys       map[string]jwtKey // kid -> 密钥
+}
+
+// jwtKey 密钥以及 JWKS 中限定的算法
+type jwtKey struct {
+	key interface{}
+	alg string
+}
+
+// NewJWTVerifier 创建 JWTVerifier
+func NewJWTVerifier(conf JWTConfig) (*JWTVerifier, error) {
+	v := &JWTVerifier{conf: conf}
+	if len(conf.Algorithms) > 0 {
+		v.algorithms = make(map[string]bool)
+		for _, alg := range conf.Algorithms {
+			v.algorithms[alg] = true
+		}
+	}
+	if err := v.Reload(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Reload 重新加载 JWKS 文件，用于密钥轮换
+func (v *JWTVerifier) Reload() error {
+	keys := make(map[string]jwtKey)
+	if v.conf.Key != nil {
+		keys[""] = jwtKey{key: v.conf.Key}
+	}
+	for kid, key := range v.conf.Keys {
+		keys[kid] = jwtKey{key: key}
+	}
+	if v.conf.JWKSFile != "" {
+		data, err := os.ReadFile(v.conf.JWKSFile)
+		if err != nil {
+			return fmt.Errorf("gambler: load jwks: %w", err)
+		}
+		jwks, err := parseJWKS(data)
+		if err != nil {
+			return err
+		}
+		for kid, key := range jwks {
+			keys[kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return errors.New("gambler: jwt needs Key, Keys or JWKSFile")
+	}
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+	return nil
+}
+
+// jwtHeader JWT 的头部
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// Verify 校验 token 并返回 claims
+func (v *JWTVerifier) Verify(token string) (*JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrJWTMalformed
+	}
+	var header jwtHeader
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg == "" || strings.EqualFold(header.Alg, "none") || v.algorithms != nil && !v.algorithms[header.Alg] {
+		return nil, ErrJWTUnsupportedAlg
+	}
+	key, err := v.lookupKey(header)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrJWTMalformed
+	}
+	if err := verifyJWTSignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrJWTMalformed
+	}
+	claims, err := parseJWTClaims(payload)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.validateClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// lookupKey 根据 kid 查找密钥，没有 kid 时使用静态 Key，或者唯一的那个密钥
+func (v *JWTVerifier) lookupKey(header jwtHeader) (jwtKey, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	key, ok := v.keys[header.Kid]
+	if !ok && header.Kid == "" && len(v.keys) == 1 {
+		for _, only := range v.keys {
+			key, ok = only, true
+		}
+	}
+	if !ok {
+		return jwtKey{}, ErrJWTKeyNotFound
+	}
+	// JWKS 中限定了算法时，token 的算法必须一致，防止算法混淆攻击
+	if key.alg != "" && key.alg != header.Alg {
+		return jwtKey{}, ErrJWTUnsupportedAlg
+	}
+	return key, nil
+}
+
+// validateClaims 校验 exp、nbf、iss、aud
+func (v *JWTVerifier) validateClaims(claims *JWTClaims, now time.Time) error {
+	skew := int64(v.conf.ClockSkew / time.Second)
+	unix := now.Unix()
+	if claims.ExpiresAt != 0 && unix > claims.ExpiresAt+skew {
+		return ErrJWTExpired
+	}
+	if claims.NotBefore != 0 && unix+skew < claims.NotBefore {
+		return ErrJWTNotValidYet
+	}
+	if v.conf.Issuer != "" && claims.Issuer != v.conf.Issuer {
+		return ErrJWTInvalidIssuer
+	}
+	if v.conf.Audience != "" {
+		for _, aud := range claims.Audience {
+			if aud == v.conf.Audience {
+				return nil
+			}
+		}
+		return ErrJWTInvalidAudience
+	}
+	return nil
+}
+
+// decodeJWTSegment 解码 base64url 编码的 JSON
+func decodeJWTSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return ErrJWTMalformed
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return ErrJWTMalformed
+	}
+	return nil
+}
+
+// parseJWTClaims 解析标准 claims，时间字段可能是浮点数，aud 可能是字符串或者数组
+func parseJWTClaims(payload []byte) (*JWTClaims, error) {
+	var raw map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, ErrJWTMalformed
+	}
+	claims := &JWTClaims{payload: payload}
+	claims.Issuer, _ = raw["iss"].(string)
+	claims.Subject, _ = raw["sub"].(string)
+	claims.ID, _ = raw["jti"].(string)
+	switch aud := raw["aud"].(type) {
+	case string:
+		claims.Audience = []string{aud}
+	case []interface{}:
+		for _, item := range aud {
+			if s, ok := item.(string); ok {
+				claims.Audience = append(claims.Audience, s)
+			}
+		}
+	}
+	for name, field := range map[string]*int64{"exp": &claims.ExpiresAt, "nbf": &claims.NotBefore, "iat": &claims.IssuedAt} {
+		value, ok := raw[name]
+		if !ok {
+			continue
+		}
+		number, ok := value.(json.Number)
+		if !ok {
+			return nil, ErrJWTMalformed
+		}
+		f, err := number.Float64()
+		if err != nil {
+			return nil, ErrJWTMalformed
+		}
+		*field = int64(f)
+	}
+	return claims, nil
+}
+
+// verifyJWTSignature 校验签名，密钥类型必须和算法匹配
+func verifyJWTSignature(alg string, key jwtKey, signed, signature []byte) error {
+	if len(alg) < 5 {
+		return ErrJWTUnsupportedAlg
+	}
+	var hash crypto.Hash
+	switch alg[len(alg)-3:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	}
+	switch {
+	case alg == "HS256" || alg == "HS384" || alg == "HS512":
+		secret, ok := key.key.([]byte)
+		if !ok {
+			return ErrJWTUnsupportedAlg
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return ErrJWTInvalidSignature
+		}
+	case alg == "RS256" || alg == "RS384" || alg == "RS512":
+		pub, ok := key.key.(*rsa.PublicKey)
+		if !ok {
+			return ErrJWTUnsupportedAlg
+		}
+		h := hash.New()
+		h.Write(signed)
+		if rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), signature) != nil {
+			return ErrJWTInvalidSignature
+		}
+	case alg == "ES256" || alg == "ES384" || alg == "ES512":
+		pub, ok := key.key.(*ecdsa.PublicKey)
+		// ES 算法绑定了曲线：ES256 -> P-256，ES384 -> P-384，ES512 -> P-521，曲线不一致时拒绝
+		if !ok || pub.Curve.Params().Name != esCurves[alg] {
+			return ErrJWTUnsupportedAlg
+		}
+		// ES 算法的签名是定长的 r || s
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return ErrJWTInvalidSignature
+		}
+		h := hash.New()
+		h.Write(signed)
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, h.Sum(nil), r, s) {
+			return ErrJWTInvalidSignature
+		}
+	case alg == "EdDSA":
+		pub, ok := key.key.(ed25519.PublicKey)
+		if !ok {
+			return ErrJWTUnsupportedAlg
+		}
+		if !ed25519.Verify(pub, signed, signature) {
+			return ErrJWTInvalidSignature
+		}
+	default:
+		return ErrJWTUnsupportedAlg
+	}
+	return nil
+}
+
+// esCurves ES 算法对应的曲线
+var esCurves = map[string]string{"ES256": "P-256", "ES384": "P-384", "ES512": "P-521"}
+
+// jwk JWKS 中的一个密钥
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// parseJWKS 解析 JWKS 文档，返回 kid -> 密钥，支持 RSA、EC、OKP(Ed25519) 和 oct 类型
+// 用途不是签名校验(use 不为 sig)的密钥会被忽略
+func parseJWKS(data []byte) (map[string]jwtKey, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("gambler: parse jwks: %w", err)
+	}
+	keys := make(map[string]jwtKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("gambler: parse jwk %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = jwtKey{key: key, alg: k.Alg}
+	}
+	return keys, nil
+}
+
+// publicKey 把 JWK 转换成 Go 的密钥类型
+func (k jwk) publicKey() (interface{}, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return pub, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		return decode(k.K)
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
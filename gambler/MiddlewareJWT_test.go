@@ -0,0 +1,146 @@
+package gambler
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// signJWT 测试用的签名函数
+func signJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		s.FillBytes(sig[size:])
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWTVerifierStaticKeys(t *testing.T) {
+	now := time.Now().Unix()
+	claims := map[string]interface{}{"sub": "liup2", "iss": "gambler", "aud": []string{"api"}, "exp": now + 60, "role": "admin"}
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	secret := []byte("secret")
+
+	verifier, err := NewJWTVerifier(JWTConfig{
+		Keys:     map[string]interface{}{"hs": secret, "rs": &rsaKey.PublicKey, "es": &ecKey.PublicKey, "ed": edPub},
+		Issuer:   "gambler",
+		Audience: "api",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{
+		signJWT(t, "HS256", "hs", secret, claims),
+		signJWT(t, "RS256", "rs", rsaKey, claims),
+		signJWT(t, "ES256", "es", ecKey, claims),
+		signJWT(t, "EdDSA", "ed", edKey, claims),
+	} {
+		parsed, err := verifier.Verify(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var custom struct {
+			Role string `json:"role"`
+		}
+		if parsed.Subject != "liup2" || parsed.Decode(&custom) != nil || custom.Role != "admin" {
+			t.Fatalf("unexpected claims: %+v %+v", parsed, custom)
+		}
+	}
+
+	// 用 RSA 公钥当作 HMAC 密钥的算法混淆攻击
+	if _, err := verifier.Verify(signJWT(t, "HS256", "rs", secret, claims)); err != ErrJWTUnsupportedAlg {
+		t.Fatalf("algorithm confusion should be rejected, got %v", err)
+	}
+	// ES256 只能使用 P-256 的密钥，用 P-384 的密钥签名的 ES256 token 需要拒绝
+	p384Key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	mismatched, _ := NewJWTVerifier(JWTConfig{Key: &p384Key.PublicKey})
+	if _, err := mismatched.Verify(signJWT(t, "ES256", "", p384Key, claims)); err != ErrJWTUnsupportedAlg {
+		t.Fatalf("curve mismatch should be rejected, got %v", err)
+	}
+	expired := map[string]interface{}{"iss": "gambler", "aud": "api", "exp": now - 10}
+	if _, err := verifier.Verify(signJWT(t, "HS256", "hs", secret, expired)); err != ErrJWTExpired {
+		t.Fatalf("expired token should be rejected, got %v", err)
+	}
+	skewed, _ := NewJWTVerifier(JWTConfig{Key: secret, ClockSkew: 30 * time.Second})
+	if _, err := skewed.Verify(signJWT(t, "HS256", "", secret, expired)); err != nil {
+		t.Fatalf("clock skew should be allowed, got %v", err)
+	}
+	wrongAud := map[string]interface{}{"iss": "gambler", "aud": "other", "exp": now + 60}
+	if _, err := verifier.Verify(signJWT(t, "HS256", "hs", secret, wrongAud)); err != ErrJWTInvalidAudience {
+		t.Fatalf("wrong audience should be rejected, got %v", err)
+	}
+}
+
+func TestMiddlewareJWTWithJWKSFile(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	encode := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.FillBytes(make([]byte, 32))) }
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "EC", "kid": "k1", "alg": "ES256", "use": "sig", "crv": "P-256", "x": encode(ecKey.X), "y": encode(ecKey.Y)},
+	}})
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(file, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := New()
+	r.UseMiddlewares(MiddlewareJWT(JWTConfig{JWKSFile: file, Lookup: "header:Authorization,cookie:jwt"}))
+	r.GET("/me", func(c *Context) {
+		c.String(http.StatusOK, "%s", c.JWTClaims().Subject)
+	})
+
+	token := signJWT(t, "ES256", "k1", ecKey, map[string]interface{}{"sub": "liup2", "exp": time.Now().Unix() + 60})
+	req := httptest.NewRequest("GET", "/me", nil)
+	req.AddCookie(&http.Cookie{Name: "jwt", Value: token})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "liup2" {
+		t.Fatalf("valid token should pass, got %d %q", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token+"x")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("tampered token should be rejected, got %d", w.Code)
+	}
+}
@@ -1,15 +1,322 @@
 package gambler
 
 import (
-	"log"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+// MiddlewareLogger.go: 访问日志中间件，每个请求结束后输出一行访问日志
+// 支持 Apache common / combined 格式、JSON lines 格式，以及使用 ${field} 占位符的自定义格式
+
+// 访问日志的内置格式
+const (
+	LogFormatDefault  = "[GAMBLER] ${time} | ${status} | ${latency} | ${ip} | ${method} ${path}"
+	LogFormatCommon   = "common"   // Apache common: 127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /hello HTTP/1.1" 200 2326
+	LogFormatCombined = "combined" // Apache combined: common 格式后面追加 "referer" "user-agent"
+	LogFormatJSON     = "json"     // 每个请求输出一行 JSON
+)
+
+// LoggerConfig 访问日志的配置
+// 自定义格式中可以使用的字段：
+// ${time} ${ip} ${method} ${path} ${uri} ${proto} ${status} ${bytes} ${latency} ${user_agent} ${referer} ${request_id}
+type LoggerConfig struct {
+	Format     string                // 日志格式，可以是内置格式的名称或者自定义格式，默认 LogFormatDefault
+	Output     io.Writer             // 日志输出，默认 os.Stdout
+	SkipPaths  []string              // 不输出日志的路径，eg: /healthz
+	Skip       func(c *Context) bool // 返回 true 时不输出日志
+	TimeFormat string                // ${time} 的格式，默认 2006/01/02 - 15:04:05
+	Color      *bool                 // 状态码和请求方式是否带颜色，nil 表示 Output 是终端时自动开启
+}
+
+// 终端颜色
+const (
+	colorGreen  = "\033[97;42m"
+	colorWhite  = "\033[90;47m"
+	colorYellow = "\033[90;43m"
+	colorRed    = "\033[97;41m"
+	colorBlue   = "\033[97;44m"
+	colorCyan   = "\033[97;46m"
+	colorReset  = "\033[0m"
+)
+
+// accessLogEntry 一次请求的访问日志信息
+type accessLogEntry struct {
+	Time      time.Time     `json:"-"`
+	TimeStr   string        `json:"time"`
+	IP        string        `json:"ip"`
+	Method    string        `json:"method"`
+	Path      string        `json:"path"`
+	URI       string        `json:"uri"`
+	Proto     string        `json:"proto"`
+	Status    int           `json:"status"`
+	Bytes     int           `json:"bytes"`
+	Latency   time.Duration `json:"-"`
+	LatencyMs float64       `json:"latency_ms"`
+	UserAgent string        `json:"user_agent"`
+	Referer   string        `json:"referer"`
+	RequestID string        `json:"request_id,omitempty"`
+}
+
+// logSegment 预先解析好的格式片段，field 为空时表示原样输出 text
+type logSegment struct {
+	text  string
+	field string
+}
+
+// MiddlewareLogger 使用默认配置的访问日志中间件
 func MiddlewareLogger() HandlerFunc {
+	return MiddlewareLoggerWithConfig(LoggerConfig{})
+}
+
+// MiddlewareLoggerWithConfig 根据配置创建访问日志中间件
+func MiddlewareLoggerWithConfig(conf LoggerConfig) HandlerFunc {
+	if conf.Format == "" {
+		conf.Format = LogFormatDefault
+	}
+	if conf.Output == nil {
+		conf.Output = os.Stdout
+	}
+	if conf.TimeFormat == "" {
+		conf.TimeFormat = "2006/01/02 - 15:04:05"
+	}
+	color := isTerminal(conf.Output)
+	if conf.Color != nil {
+		color = *conf.Color
+	}
+	skip := make(map[string]bool, len(conf.SkipPaths))
+	for _, path := range conf.SkipPaths {
+		skip[path] = true
+	}
+	// 自定义格式只在创建中间件时解析一次
+	var segments []logSegment
+	switch conf.Format {
+	case LogFormatCommon, LogFormatCombined, LogFormatJSON:
+	default:
+		segments = parseLogFormat(conf.Format)
+	}
+	var mu sync.Mutex
 	return func(c *Context) {
+		if skip[c.Path] {
+			c.Next()
+			return
+		}
 		t := time.Now()
-		log.Printf("Debug msg : MiddlewareLogger.go -> MiddlewareLogger : START middle ware [ MiddlewareLogger ]\n")
 		c.Next()
-		log.Printf("Debug msg : MiddlewareLogger.go -> logger : END middle ware [ MiddlewareLogger ] with msg = [%d] %s in %v\n\n", c.StatusCode, c.Req.RequestURI, time.Since(t))
+		if conf.Skip != nil && conf.Skip(c) {
+			return
+		}
+		entry := newAccessLogEntry(c, t)
+		var line []byte
+		switch conf.Format {
+		case LogFormatCommon:
+			line = entry.common(nil)
+		case LogFormatCombined:
+			line = entry.combined(nil)
+		case LogFormatJSON:
+			entry.TimeStr = entry.Time.Format(time.RFC3339)
+			entry.LatencyMs = float64(entry.Latency) / float64(time.Millisecond)
+			line, _ = json.Marshal(entry)
+		default:
+			entry.TimeStr = entry.Time.Format(conf.TimeFormat)
+			line = entry.custom(segments, color)
+		}
+		line = append(line, '\n')
+		mu.Lock()
+		conf.Output.Write(line)
+		mu.Unlock()
+	}
+}
+
+// newAccessLogEntry 从 Context 中收集访问日志需要的信息
+func newAccessLogEntry(c *Context, start time.Time) *accessLogEntry {
+	entry := &accessLogEntry{
+		Time:      start,
+		IP:        c.ClientIP(),
+		Method:    c.Method,
+		Path:      c.Path,
+		URI:       c.Req.RequestURI,
+		Proto:     c.Req.Proto,
+		Status:    c.StatusCode,
+		Latency:   time.Since(start),
+		UserAgent: c.Req.UserAgent(),
+		Referer:   c.Req.Referer(),
+		RequestID: c.RequestID(),
+	}
+	if c.resp != nil {
+		entry.Status = c.resp.Status()
+		entry.Bytes = c.resp.Size()
+	}
+	if entry.URI == "" {
+		entry.URI = c.Req.URL.RequestURI()
+	}
+	return entry
+}
+
+// common 输出 Apache common 格式
+func (e *accessLogEntry) common(buf []byte) []byte {
+	buf = append(buf, e.IP...)
+	buf = append(buf, " - - ["...)
+	buf = append(buf, e.Time.Format("02/Jan/2006:15:04:05 -0700")...)
+	buf = append(buf, "] \""...)
+	buf = append(buf, e.Method...)
+	buf = append(buf, ' ')
+	buf = append(buf, escapeLogValue(e.URI)...)
+	buf = append(buf, ' ')
+	buf = append(buf, e.Proto...)
+	buf = append(buf, "\" "...)
+	buf = strconv.AppendInt(buf, int64(e.Status), 10)
+	buf = append(buf, ' ')
+	if e.Bytes == 0 {
+		buf = append(buf, '-')
+	} else {
+		buf = strconv.AppendInt(buf, int64(e.Bytes), 10)
+	}
+	return buf
+}
+
+// combined 输出 Apache combined 格式，在 common 格式后面加上 Referer 和 User-Agent，为空时和 Apache 一样输出 "-"
+func (e *accessLogEntry) combined(buf []byte) []byte {
+	buf = e.common(buf)
+	for _, value := range []string{e.Referer, e.UserAgent} {
+		buf = append(buf, " \""...)
+		if value == "" {
+			buf = append(buf, '-')
+		} else {
+			buf = append(buf, escapeLogValue(value)...)
+		}
+		buf = append(buf, '"')
+	}
+	return buf
+}
+
+// custom 按照自定义格式输出
+func (e *accessLogEntry) custom(segments []logSegment, color bool) []byte {
+	buf := make([]byte, 0, 128)
+	for _, seg := range segments {
+		switch seg.field {
+		case "":
+			buf = append(buf, seg.text...)
+		case "time":
+			buf = append(buf, e.TimeStr...)
+		case "ip":
+			buf = append(buf, e.IP...)
+		case "method":
+			if color {
+				buf = append(buf, methodColor(e.Method)...)
+			}
+			buf = append(buf, e.Method...)
+			if color {
+				buf = append(buf, colorReset...)
+			}
+		case "path":
+			buf = append(buf, escapeLogValue(e.Path)...)
+		case "uri":
+			buf = append(buf, escapeLogValue(e.URI)...)
+		case "proto":
+			buf = append(buf, e.Proto...)
+		case "status":
+			if color {
+				buf = append(buf, statusColor(e.Status)...)
+			}
+			buf = strconv.AppendInt(buf, int64(e.Status), 10)
+			if color {
+				buf = append(buf, colorReset...)
+			}
+		case "bytes":
+			buf = strconv.AppendInt(buf, int64(e.Bytes), 10)
+		case "latency":
+			buf = append(buf, e.Latency.String()...)
+		case "user_agent":
+			buf = append(buf, escapeLogValue(e.UserAgent)...)
+		case "referer":
+			buf = append(buf, escapeLogValue(e.Referer)...)
+		case "request_id":
+			buf = append(buf, e.RequestID...)
+		}
+	}
+	return buf
+}
+
+// parseLogFormat 把 "${ip} ${method}" 这样的格式解析成片段，未知的字段原样输出
+func parseLogFormat(format string) []logSegment {
+	known := map[string]bool{
+		"time": true, "ip": true, "method": true, "path": true, "uri": true, "proto": true, "status": true,
+		"bytes": true, "latency": true, "user_agent": true, "referer": true, "request_id": true,
+	}
+	segments := make([]logSegment, 0)
+	for format != "" {
+		start := strings.Index(format, "${")
+		if start < 0 {
+			segments = append(segments, logSegment{text: format})
+			break
+		}
+		end := strings.IndexByte(format[start:], '}')
+		if end < 0 {
+			segments = append(segments, logSegment{text: format})
+			break
+		}
+		end += start
+		if start > 0 {
+			segments = append(segments, logSegment{text: format[:start]})
+		}
+		if name := format[start+2 : end]; known[name] {
+			segments = append(segments, logSegment{field: name})
+		} else {
+			segments = append(segments, logSegment{text: format[start : end+1]})
+		}
+		format = format[end+1:]
+	}
+	return segments
+}
+
+// escapeLogValue 转义引号和控制字符，防止伪造日志行
+func escapeLogValue(s string) string {
+	quoted := strconv.Quote(s)
+	return quoted[1 : len(quoted)-1]
+}
+
+// statusColor 根据状态码选择颜色
+func statusColor(code int) string {
+	switch {
+	case code >= 200 && code < 300:
+		return colorGreen
+	case code >= 300 && code < 400:
+		return colorWhite
+	case code >= 400 && code < 500:
+		return colorYellow
+	}
+	return colorRed
+}
+
+// methodColor 根据请求方式选择颜色
+func methodColor(method string) string {
+	switch method {
+	case "GET":
+		return colorBlue
+	case "POST":
+		return colorCyan
+	case "PUT":
+		return colorYellow
+	case "DELETE":
+		return colorRed
+	}
+	return colorWhite
+}
+
+// isTerminal 判断输出是否是终端
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
 	}
+	return info.Mode()&os.ModeCharDevice != 0
 }
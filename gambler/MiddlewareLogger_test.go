@@ -0,0 +1,86 @@
+package gambler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newLoggerTestEngine(conf LoggerConfig) *Engine {
+	r := New()
+	r.UseMiddlewares(MiddlewareLoggerWithConfig(conf))
+	r.GET("/hello", func(c *Context) {
+		c.String(http.StatusOK, "hello")
+	})
+	return r
+}
+
+func TestMiddlewareLoggerCommon(t *testing.T) {
+	var buf bytes.Buffer
+	r := newLoggerTestEngine(LoggerConfig{Format: LogFormatCommon, Output: &buf})
+	req := httptest.NewRequest("GET", "/hello?name=liup2", nil)
+	req.Header.Set("Referer", "http://example.com/")
+	req.Header.Set("User-Agent", "test-agent")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	out := buf.String()
+	if !strings.HasPrefix(out, "192.0.2.1 - - [") || !strings.HasSuffix(out, `"GET /hello?name=liup2 HTTP/1.1" 200 5`+"\n") {
+		t.Fatalf("unexpected common log: %s", out)
+	}
+	if strings.Contains(out, "example.com") || strings.Contains(out, "test-agent") {
+		t.Fatalf("common log should not contain referer or user-agent: %s", out)
+	}
+}
+
+func TestMiddlewareLoggerCombined(t *testing.T) {
+	var buf bytes.Buffer
+	r := newLoggerTestEngine(LoggerConfig{Format: LogFormatCombined, Output: &buf})
+	req := httptest.NewRequest("GET", "/hello?name=liup2", nil)
+	req.Header.Set("User-Agent", "test-agent")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	out := buf.String()
+	if !strings.HasPrefix(out, "192.0.2.1 - - [") {
+		t.Fatalf("unexpected combined log: %s", out)
+	}
+	if !strings.HasSuffix(out, `"GET /hello?name=liup2 HTTP/1.1" 200 5 "-" "test-agent"`+"\n") {
+		t.Fatalf("unexpected combined log: %s", out)
+	}
+
+	// Referer 和 User-Agent 都为空时输出 "-"
+	buf.Reset()
+	req = httptest.NewRequest("GET", "/hello", nil)
+	req.Header.Del("User-Agent")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if out = buf.String(); !strings.HasSuffix(out, `"GET /hello HTTP/1.1" 200 5 "-" "-"`+"\n") {
+		t.Fatalf("empty referer and user agent should be logged as \"-\": %s", out)
+	}
+}
+
+func TestMiddlewareLoggerJSON(t *testing.T) {
+	var buf bytes.Buffer
+	r := newLoggerTestEngine(LoggerConfig{Format: LogFormatJSON, Output: &buf})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/notfound", nil))
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["status"] != float64(http.StatusNotFound) || entry["path"] != "/notfound" {
+		t.Fatalf("unexpected json log: %s", buf.String())
+	}
+}
+
+func TestMiddlewareLoggerCustomAndSkip(t *testing.T) {
+	var buf bytes.Buffer
+	r := newLoggerTestEngine(LoggerConfig{
+		Format:    "${method} ${path} ${status} ${bytes} ${unknown}",
+		Output:    &buf,
+		SkipPaths: []string{"/healthz"},
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/healthz", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hello", nil))
+	if buf.String() != "GET /hello 200 5 ${unknown}\n" {
+		t.Fatalf("unexpected custom log: %q", buf.String())
+	}
+}
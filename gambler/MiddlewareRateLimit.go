@@ -0,0 +1,283 @@
+package gambler
+
+import (
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MiddlewareRateLimit.go: 限流中间件，支持令牌桶和滑动窗口两种算法
+// 限流的 key 可以是客户端 IP、路由或者自定义函数，每个 key 的状态保存在 RateLimitStore 中
+// 响应头中会返回 RateLimit-Limit、RateLimit-Remaining、RateLimit-Reset，被限流时额外返回 Retry-After
+
+// RateLimitResult 一次限流判断的结果
+type RateLimitResult struct {
+	Allowed    bool          // 是否允许这次请求
+	Limit      int           // 额度上限
+	Remaining  int           // 剩余额度
+	Reset      time.Duration // 多久之后额度完全恢复
+	RetryAfter time.Duration // 被限流时，多久之后可以重试
+}
+
+// RateLimitAlgorithm 限流算法，为每个 key 创建一个 RateLimitBucket 保存状态
+type RateLimitAlgorithm interface {
+	NewBucket(now time.Time) RateLimitBucket
+}
+
+// RateLimitBucket 某个 key 的限流状态，由 Store 负责加锁
+type RateLimitBucket interface {
+	// Take 消耗一次额度
+	Take(now time.Time) RateLimitResult
+	// Idle 状态已经恢复到初始值，可以被清理
+	Idle(now time.Time) bool
+}
+
+// RateLimitStore 保存所有 key 的限流状态，多实例部署时可以用 Redis 等实现共享的 Store
+type RateLimitStore interface {
+	Take(key string, now time.Time) (RateLimitResult, error)
+}
+
+// RateLimitConfig 限流中间件的配置
+type RateLimitConfig struct {
+	Algorithm RateLimitAlgorithm      // 限流算法，Store 为空时用它创建内存 Store
+	Store     RateLimitStore          // 限流状态的存储
+	KeyFunc   func(c *Context) string // 限流的 key，默认 KeyByClientIP
+	Handler   HandlerFunc             // 被限流时的响应，默认返回 429
+	Skip      func(c *Context) bool   // 返回 true 时不限流
+}
+
+// MiddlewareRateLimit 按照客户端 IP 限流，eg: MiddlewareRateLimit(TokenBucket{Rate: 1, Burst: 5})
+func MiddlewareRateLimit(algorithm RateLimitAlgorithm) HandlerFunc {
+	return MiddlewareRateLimitWithConfig(RateLimitConfig{Algorithm: algorithm})
+}
+
+// MiddlewareRateLimitWithConfig 根据配置创建限流中间件
+func MiddlewareRateLimitWithConfig(conf RateLimitConfig) HandlerFunc {
+	if conf.Store == nil {
+		if conf.Algorithm == nil {
+			panic("gambler: rate limit needs an Algorithm or a Store")
+		}
+		conf.Store = NewMemoryStore(conf.Algorithm)
+	}
+	if conf.KeyFunc == nil {
+		conf.KeyFunc = KeyByClientIP
+	}
+	if conf.Handler == nil {
+		conf.Handler = func(c *Context) {
+			c.Fail(http.StatusTooManyRequests, "Too Many Requests")
+		}
+	}
+	return func(c *Context) {
+		if conf.Skip != nil && conf.Skip(c) {
+			c.Next()
+			return
+		}
+		result, err := conf.Store.Take(conf.KeyFunc(c), time.Now())
+		if err != nil {
+			// Store 不可用时放行，避免限流组件故障导致整个服务不可用
+			c.Logger().Error("rate limit store failed", F("error", err))
+			c.Next()
+			return
+		}
+		header := c.Writer.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.Abort()
+			conf.Handler(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// KeyByClientIP 按照客户端 IP 限流
+func KeyByClientIP(c *Context) string {
+	return c.ClientIP()
+}
+
+// KeyByRoute 按照路由限流，所有客户端共享同一个路由的额度，eg: POST /login
+func KeyByRoute(c *Context) string {
+	return c.Method + " " + c.FullPath()
+}
+
+// KeyByRouteAndIP 按照路由和客户端 IP 限流，每个客户端在每个路由上有独立的额度
+func KeyByRouteAndIP(c *Context) string {
+	return c.Method + " " + c.FullPath() + " " + c.ClientIP()
+}
+
+// ceilSeconds 向上取整到秒
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
+
+// TokenBucket 令牌桶算法：令牌以 Rate 个每秒的速度放入桶中，桶最多容纳 Burst 个，每个请求消耗一个令牌
+type TokenBucket struct {
+	Rate  float64 // 每秒放入的令牌数
+	Burst int     // 桶的容量，也就是允许的突发请求数
+}
+
+// NewBucket 新的桶是满的
+func (tb TokenBucket) NewBucket(now time.Time) RateLimitBucket {
+	return &tokenBucket{conf: tb, tokens: float64(tb.Burst), last: now}
+}
+
+type tokenBucket struct {
+	conf   TokenBucket
+	tokens float64
+	last   time.Time
+}
+
+// refill 根据距离上次的时间补充令牌
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(b.conf.Burst), b.tokens+elapsed.Seconds()*b.conf.Rate)
+		b.last = now
+	}
+}
+
+func (b *tokenBucket) Take(now time.Time) RateLimitResult {
+	b.refill(now)
+	result := RateLimitResult{Limit: b.conf.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = b.duration(1 - b.tokens)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = b.duration(float64(b.conf.Burst) - b.tokens)
+	return result
+}
+
+func (b *tokenBucket) Idle(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= float64(b.conf.Burst)
+}
+
+// duration 补充 tokens 个令牌需要的时间
+func (b *tokenBucket) duration(tokens float64) time.Duration {
+	if b.conf.Rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(tokens / b.conf.Rate * float64(time.Second))
+}
+
+// SlidingWindow 滑动窗口算法：统计最近 Window 时间内的请求数，不超过 Limit
+// 使用上一个窗口和当前窗口两个计数器按照时间比例估算，内存占用固定
+type SlidingWindow struct {
+	Limit  int           // 窗口内允许的请求数
+	Window time.Duration // 窗口长度
+}
+
+// NewBucket 从当前时间所在的窗口开始计数
+func (sw SlidingWindow) NewBucket(now time.Time) RateLimitBucket {
+	return &slidingWindow{conf: sw, start: now.Truncate(sw.Window)}
+}
+
+type slidingWindow struct {
+	conf  SlidingWindow
+	start time.Time // 当前窗口的开始时间
+	prev  int       // 上一个窗口的请求数
+	curr  int       // 当前窗口的请求数
+}
+
+// advance 进入新的窗口时滚动计数器
+func (b *slidingWindow) advance(now time.Time) {
+	start := now.Truncate(b.conf.Window)
+	if !start.After(b.start) {
+		return
+	}
+	if start.Sub(b.start) == b.conf.Window {
+		b.prev = b.curr
+	} else {
+		b.prev = 0
+	}
+	b.curr = 0
+	b.start = start
+}
+
+func (b *slidingWindow) Take(now time.Time) RateLimitResult {
+	b.advance(now)
+	elapsed := now.Sub(b.start)
+	weight := 1 - float64(elapsed)/float64(b.conf.Window)
+	estimated := float64(b.prev)*weight + float64(b.curr)
+	result := RateLimitResult{Limit: b.conf.Limit, Reset: b.conf.Window - elapsed}
+	if estimated+1 <= float64(b.conf.Limit) {
+		b.curr++
+		estimated++
+		result.Allowed = true
+	} else if b.prev == 0 || b.curr+1 > b.conf.Limit {
+		// 只能等到下一个窗口
+		result.RetryAfter = b.conf.Window - elapsed
+	} else {
+		// 等到上一个窗口的权重降到足够低：prev * (1 - t/window) + curr + 1 <= limit
+		t := (1 - float64(b.conf.Limit-1-b.curr)/float64(b.prev)) * float64(b.conf.Window)
+		result.RetryAfter = time.Duration(t) - elapsed
+	}
+	result.Remaining = b.conf.Limit - int(math.Ceil(estimated))
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	return result
+}
+
+func (b *slidingWindow) Idle(now time.Time) bool {
+	return now.Sub(b.start) >= 2*b.conf.Window
+}
+
+// memoryStoreShards 内存 Store 的分片数，减少锁竞争
+const memoryStoreShards = 64
+
+// MemoryStore 基于内存的分片 Store，只适用于单实例部署
+type MemoryStore struct {
+	algorithm RateLimitAlgorithm
+	shards    [memoryStoreShards]memoryShard
+}
+
+type memoryShard struct {
+	mu        sync.Mutex
+	buckets   map[string]RateLimitBucket
+	lastSweep time.Time
+}
+
+// NewMemoryStore 创建内存 Store
+func NewMemoryStore(algorithm RateLimitAlgorithm) *MemoryStore {
+	s := &MemoryStore{algorithm: algorithm}
+	for i := range s.shards {
+		s.shards[i].buckets = make(map[string]RateLimitBucket)
+	}
+	return s
+}
+
+// Take 对 key 消耗一次额度
+func (s *MemoryStore) Take(key string, now time.Time) (RateLimitResult, error) {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	shard := &s.shards[h.Sum32()%memoryStoreShards]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	// 每分钟清理一次已经恢复的 key，防止 map 无限增长
+	if now.Sub(shard.lastSweep) > time.Minute {
+		for k, bucket := range shard.buckets {
+			if bucket.Idle(now) {
+				delete(shard.buckets, k)
+			}
+		}
+		shard.lastSweep = now
+	}
+	bucket, ok := shard.buckets[key]
+	if !ok {
+		bucket = s.algorithm.NewBucket(now)
+		shard.buckets[key] = bucket
+	}
+	return bucket.Take(now), nil
+}
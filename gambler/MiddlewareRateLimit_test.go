@@ -0,0 +1,61 @@
+package gambler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	bucket := TokenBucket{Rate: 1, Burst: 2}.NewBucket(now)
+	if !bucket.Take(now).Allowed || !bucket.Take(now).Allowed {
+		t.Fatal("burst requests should be allowed")
+	}
+	result := bucket.Take(now)
+	if result.Allowed || result.RetryAfter != time.Second {
+		t.Fatalf("third request should be limited, got %+v", result)
+	}
+	if !bucket.Take(now.Add(time.Second)).Allowed {
+		t.Fatal("token should be refilled after one second")
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	start := time.Unix(1000, 0)
+	bucket := SlidingWindow{Limit: 2, Window: 10 * time.Second}.NewBucket(start)
+	bucket.Take(start)
+	bucket.Take(start)
+	if bucket.Take(start.Add(5 * time.Second)).Allowed {
+		t.Fatal("limit should be reached in the window")
+	}
+	// 下一个窗口开始时，上一个窗口的 2 个请求权重接近 1，仍然被限流
+	if bucket.Take(start.Add(10 * time.Second)).Allowed {
+		t.Fatal("previous window should still be counted")
+	}
+	if !bucket.Take(start.Add(16 * time.Second)).Allowed {
+		t.Fatal("request should be allowed after the previous window slides out")
+	}
+}
+
+func TestMiddlewareRateLimit(t *testing.T) {
+	r := New()
+	r.UseMiddlewares(MiddlewareRateLimitWithConfig(RateLimitConfig{
+		Algorithm: TokenBucket{Rate: 0.5, Burst: 1},
+		KeyFunc:   KeyByRouteAndIP,
+	}))
+	r.POST("/login", func(c *Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/login", nil))
+	if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "1" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("first request should be allowed, got %d %v", w.Code, w.Header())
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/login", nil))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Fatalf("second request should be limited, got %d %v", w.Code, w.Header())
+	}
+}
@@ -1,14 +1,34 @@
 package gambler
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
+	"net/http/httputil"
 	"runtime"
 	"strings"
+	"syscall"
+	"time"
 )
 
-//用来获取触发 panic 的堆栈信息
+// MiddlewareRecover.go: 错误恢复中间件，handler 发生 panic 时恢复并返回 500
+// 可以自定义恢复后的处理函数、在日志中输出脱敏后的请求，并且识别客户端断开连接的情况
+
+// RecoveryFunc 发生 panic 后的处理函数，err 是 recover 得到的值
+type RecoveryFunc func(c *Context, err interface{})
+
+// RecoveryConfig 错误恢复中间件的配置
+type RecoveryConfig struct {
+	Handler     RecoveryFunc // 恢复后的处理函数，默认返回 JSON 格式的 500
+	DumpRequest bool         // 是否在日志中输出请求，Authorization、Cookie 等请求头会被脱敏
+	Output      io.Writer    // 设置后 panic 信息以多行文本写到这里，否则通过 c.Logger() 以 Error 级别输出
+}
+
+// 需要脱敏的请求头
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key", "X-Csrf-Token"}
+
+// 用来获取触发 panic 的堆栈信息
 func trace(message string) string {
 	var pcs [32]uintptr
 	// Callers 用来返回调用栈的程序计数器, 第 0 个 Caller 是 Callers 本身，第 1 个是上一层 trace，第 2 个是再上一层的 defer func
@@ -26,21 +46,115 @@ func trace(message string) string {
 	return str.String()
 }
 
-// MiddlewareRecover 错误恢复的处理函数
+// MiddlewareRecover 使用默认配置的错误恢复中间件
 func MiddlewareRecover() HandlerFunc {
+	return MiddlewareRecoverWithConfig(RecoveryConfig{})
+}
+
+// MiddlewareRecoverWithConfig 根据配置创建错误恢复中间件
+func MiddlewareRecoverWithConfig(conf RecoveryConfig) HandlerFunc {
+	if conf.Handler == nil {
+		conf.Handler = defaultRecoveryHandler
+	}
 	return func(c *Context) {
-		log.Printf("Debug msg : MiddlewareRecover.go -> MiddlewareRecover : START middle ware [ MiddlewareRecover ]\n")
 		defer func() {
-			if err := recover(); err != nil {
-				message := fmt.Sprintf("%s", err)
-				log.Printf("Debug msg : MiddlewareRecover.go -> MiddlewareRecover : panic!  %s \n", trace(message))
-				log.Printf("Debug msg : MiddlewareRecover.go -> MiddlewareRecover : RECOVER SUCCESS\n")
-				c.Fail(http.StatusInternalServerError, "Internal Server Error")
+			err := recover()
+			if err == nil {
+				return
+			}
+			// 超时中间件在其他 goroutine 中恢复的 panic，取出原来的值，堆栈使用 handler 所在的 goroutine 的
+			var stack string
+			if p, ok := err.(*handlerPanic); ok {
+				err, stack = p.value, p.String()
+			} else {
+				stack = trace(fmt.Sprintf("%v", err))
+			}
+			// http.ErrAbortHandler 是用来主动中断响应的，交给 net/http 处理，不当作错误
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			var dump string
+			if conf.DumpRequest {
+				dump = dumpRequest(c.Req)
 			}
+			// 客户端已经断开连接，写响应也没有意义，只记录日志
+			brokenPipe := isBrokenPipe(err)
+			if conf.Output != nil {
+				writePanicReport(conf.Output, c, err, brokenPipe, dump, stack)
+			} else {
+				fields := []Field{F("method", c.Method), F("path", c.Path), F("panic", stack)}
+				if dump != "" {
+					fields = append(fields, F("request", dump))
+				}
+				if brokenPipe {
+					c.Logger().Warn("connection broken", fields...)
+				} else {
+					c.Logger().Error("panic recovered", fields...)
+				}
+			}
+			if brokenPipe {
+				c.Abort()
+				return
+			}
+			conf.Handler(c, err)
 		}()
 		// 必须要有这个next，这代表接下来执行其他中间件和用户的handler(接来来是什么取决于中间件调用的顺序)
 		c.Next()
-		// 如果没有这个就无法 recover 到用户 handler，如果发生了错误，会转到 defer去执行，所以下面的这一行log只会在没有错误时正常输出
-		log.Printf("Debug msg : MiddlewareRecover.go -> MiddlewareRecover : END middle ware [ MiddlewareRecover ]\n")
+		// 如果没有这个就无法 recover 到用户 handler，如果发生了错误，会转到 defer去执行
+	}
+}
+
+// defaultRecoveryHandler 默认返回 500
+func defaultRecoveryHandler(c *Context, err interface{}) {
+	c.Fail(http.StatusInternalServerError, "Internal Server Error")
+}
+
+// isBrokenPipe 判断 panic 是否是因为客户端断开连接(broken pipe / connection reset)
+func isBrokenPipe(err interface{}) bool {
+	e, ok := err.(error)
+	if !ok {
+		return false
+	}
+	if errors.Is(e, syscall.EPIPE) || errors.Is(e, syscall.ECONNRESET) {
+		return true
+	}
+	msg := strings.ToLower(e.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
+
+// dumpRequest 输出请求行和请求头，敏感的请求头替换为 [REDACTED]，不输出 body
+func dumpRequest(req *http.Request) string {
+	clone := *req
+	clone.Header = req.Header.Clone()
+	for _, key := range redactedHeaders {
+		if clone.Header.Get(key) != "" {
+			clone.Header.Set(key, "[REDACTED]")
+		}
+	}
+	dump, err := httputil.DumpRequest(&clone, false)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(dump))
+}
+
+// writePanicReport 以多行文本输出 panic 信息
+func writePanicReport(out io.Writer, c *Context, err interface{}, brokenPipe bool, dump, stack string) {
+	var b strings.Builder
+	title := "[Recovery] panic recovered"
+	if brokenPipe {
+		title = "[Recovery] connection broken"
+	}
+	fmt.Fprintf(&b, "%s %s %s %s", time.Now().Format("2006/01/02 - 15:04:05"), title, c.Method, c.Path)
+	if id := c.RequestID(); id != "" {
+		fmt.Fprintf(&b, " request_id=%s", id)
+	}
+	b.WriteString("\n")
+	if dump != "" {
+		b.WriteString(strings.ReplaceAll(dump, "\r\n", "\n"))
+		b.WriteString("\n")
 	}
+	b.WriteString(stack)
+	b.WriteString("\n")
+	io.WriteString(out, b.String())
 }
@@ -0,0 +1,68 @@
+package gambler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestMiddlewareRecoverWithConfig(t *testing.T) {
+	var buf bytes.Buffer
+	r := New()
+	r.UseMiddlewares(MiddlewareRecoverWithConfig(RecoveryConfig{
+		DumpRequest: true,
+		Output:      &buf,
+		Handler: func(c *Context, err interface{}) {
+			c.String(http.StatusServiceUnavailable, "recovered: %v", err)
+		},
+	}))
+	r.GET("/panic", func(c *Context) {
+		panic("boom")
+	})
+	req := httptest.NewRequest("GET", "/panic", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "recovered: boom" {
+		t.Fatalf("custom recovery handler should be used, got %d %q", w.Code, w.Body.String())
+	}
+	if strings.Contains(buf.String(), "secret-token") || !strings.Contains(buf.String(), "Authorization: [REDACTED]") {
+		t.Fatalf("authorization should be redacted, got %s", buf.String())
+	}
+}
+
+func TestMiddlewareRecoverBrokenPipe(t *testing.T) {
+	var buf bytes.Buffer
+	r := New()
+	r.UseMiddlewares(MiddlewareRecoverWithConfig(RecoveryConfig{Output: &buf}))
+	r.GET("/broken", func(c *Context) {
+		panic(fmt.Errorf("write: %w", os.NewSyscallError("write", syscall.EPIPE)))
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/broken", nil))
+	if w.Body.Len() != 0 {
+		t.Fatalf("no response should be written on broken pipe, got %q", w.Body.String())
+	}
+	if !strings.Contains(buf.String(), "connection broken") {
+		t.Fatalf("broken pipe should be logged, got %s", buf.String())
+	}
+}
+
+func TestMiddlewareRecoverAbortHandler(t *testing.T) {
+	r := New()
+	r.UseMiddlewares(MiddlewareRecover())
+	r.GET("/abort", func(c *Context) {
+		panic(http.ErrAbortHandler)
+	})
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Fatalf("http.ErrAbortHandler should be re-panicked, got %v", err)
+		}
+	}()
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/abort", nil))
+}
@@ -0,0 +1,112 @@
+package gambler
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+)
+
+// MiddlewareRequestID.go: 请求 ID 中间件，用于跨服务串联日志
+// 如果请求头中已经带有合法的请求 ID 就沿用，否则生成一个新的，保存到 Context 中并写回响应头
+
+// RequestIDKey 请求 ID 在 Context 中保存的 key
+const RequestIDKey = "gambler/request_id"
+
+// RequestIDConfig 请求 ID 中间件的配置
+type RequestIDConfig struct {
+	Header    string               // 请求 ID 所在的请求头和响应头，默认 X-Request-ID
+	Generator func() string        // 生成请求 ID，默认 NewUUIDv4
+	Validator func(id string) bool // 校验请求头中带来的 ID，不合法时重新生成，默认 ValidRequestID
+}
+
+// MiddlewareRequestID 使用默认配置的请求 ID 中间件
+func MiddlewareRequestID() HandlerFunc {
+	return MiddlewareRequestIDWithConfig(RequestIDConfig{})
+}
+
+// MiddlewareRequestIDWithConfig 根据配置创建请求 ID 中间件
+func MiddlewareRequestIDWithConfig(conf RequestIDConfig) HandlerFunc {
+	if conf.Header == "" {
+		conf.Header = "X-Request-ID"
+	}
+	if conf.Generator == nil {
+		conf.Generator = NewUUIDv4
+	}
+	if conf.Validator == nil {
+		conf.Validator = ValidRequestID
+	}
+	return func(c *Context) {
+		id := c.Req.Header.Get(conf.Header)
+		if id == "" || !conf.Validator(id) {
+			id = conf.Generator()
+		}
+		c.Set(RequestIDKey, id)
+		c.SetHeader(conf.Header, id)
+		// 之后通过 c.Logger() 输出的日志都会带上 request_id，包括 MiddlewareRecover 的 panic 日志
+		c.logger = c.Logger().With(F("request_id", id))
+		c.Next()
+	}
+}
+
+// ValidRequestID 默认的请求 ID 校验：长度不超过 128，只能包含字母、数字和 - _ . :
+// 请求 ID 会被写进日志和响应头，需要防止客户端注入换行等字符
+func ValidRequestID(id string) bool {
+	if len(id) == 0 || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		ch := id[i]
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+		case ch == '-' || ch == '_' || ch == '.' || ch == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NewUUIDv4 生成随机的 UUID v4，eg: 0b3c2a44-5f1e-4c8a-9d2b-7e6f1a2b3c4d
+func NewUUIDv4() string {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		panic(err)
+	}
+	u[6] = (u[6] & 0x0f) | 0x40 // version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // variant 10
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// crockford ULID 使用的 Crockford Base32 字母表
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID 生成 ULID，前 48 位是毫秒时间戳，后 80 位是随机数，按字典序排序即按时间排序
+// eg: 01ARZ3NDEKTSV4RRFFQ69G5FAV
+func NewULID() string {
+	var u [16]byte
+	binary.BigEndian.PutUint64(u[:8], uint64(time.Now().UnixMilli())<<16)
+	if _, err := rand.Read(u[6:]); err != nil {
+		panic(err)
+	}
+	// 128 位按照 5 位一组编码成 26 个字符，第一个字符只有 3 位
+	var buf [26]byte
+	hi := binary.BigEndian.Uint64(u[:8])
+	lo := binary.BigEndian.Uint64(u[8:])
+	for i := 25; i >= 0; i-- {
+		buf[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(buf[:])
+}
@@ -0,0 +1,56 @@
+package gambler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareRequestID(t *testing.T) {
+	r := New()
+	r.UseMiddlewares(MiddlewareRequestID())
+	r.GET("/hello", func(c *Context) {
+		c.String(http.StatusOK, "%s", c.RequestID())
+	})
+
+	// 请求头中带有合法的 ID 时沿用
+	req := httptest.NewRequest("GET", "/hello", nil)
+	req.Header.Set("X-Request-ID", "upstream-id-1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.String() != "upstream-id-1" || w.Header().Get("X-Request-ID") != "upstream-id-1" {
+		t.Fatalf("request id should be propagated, got %q", w.Body.String())
+	}
+
+	// 不合法的 ID 会被替换成 UUID
+	req = httptest.NewRequest("GET", "/hello", nil)
+	req.Header.Set("X-Request-ID", "bad\nid")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if !uuid.MatchString(w.Body.String()) {
+		t.Fatalf("request id should be a uuid v4, got %q", w.Body.String())
+	}
+}
+
+func TestRequestIDInPanicLog(t *testing.T) {
+	var buf bytes.Buffer
+	r := New()
+	r.SetLogger(NewLogger(&buf, LevelError))
+	r.UseMiddlewares(MiddlewareRecover(), MiddlewareRequestIDWithConfig(RequestIDConfig{Generator: NewULID}))
+	r.GET("/panic", func(c *Context) {
+		panic("boom")
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	id := w.Header().Get("X-Request-ID")
+	if len(id) != 26 {
+		t.Fatalf("request id should be a ulid, got %q", id)
+	}
+	if !strings.Contains(buf.String(), "request_id="+id) {
+		t.Fatalf("panic log should contain request id, got %s", buf.String())
+	}
+}
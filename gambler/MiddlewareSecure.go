@@ -0,0 +1,173 @@
+package gambler
+
+import (
+	"encoding/base64"
+	"html/template"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MiddlewareSecure.go: 安全响应头中间件，包括 HSTS、X-Content-Type-Options、X-Frame-Options、Referrer-Policy、
+// Permissions-Policy 和 Content-Security-Policy，还支持限制 Host 和 HTTP 跳转到 HTTPS
+// CSP 中的 {nonce} 会被替换成每个请求随机生成的 nonce，模板中通过 {{ cspNonce }} 获取，需要先 AddFuncMap(SecureFuncMap())
+// eg: <script nonce="{{ cspNonce }}">...</script>
+
+// CSPNonceKey 当前请求的 CSP nonce 在 Context 中保存的 key
+const CSPNonceKey = "gambler/csp_nonce"
+
+// cspNoncePlaceholder CSP 中 nonce 的占位符
+const cspNoncePlaceholder = "{nonce}"
+
+// SecureConfig 安全响应头中间件的配置，响应头的值为空时不设置
+type SecureConfig struct {
+	AllowedHosts    []string          // 允许的 Host，为空时不限制，不在其中的请求返回 400
+	SSLRedirect     bool              // HTTP 请求是否重定向到 HTTPS
+	SSLHost         string            // 重定向使用的 Host，为空时使用请求的 Host(去掉端口)
+	SSLProxyHeaders map[string]string // 反向代理终结 TLS 时用来判断原始请求是 HTTPS 的请求头，eg: {"X-Forwarded-Proto": "https"}
+
+	STSSeconds           int  // HSTS 的 max-age，为 0 时不设置，只在 HTTPS 请求中返回
+	STSIncludeSubdomains bool // HSTS 是否包含子域名
+	STSPreload           bool // HSTS 是否加入浏览器的预加载列表
+
+	ContentTypeOptions    string // X-Content-Type-Options
+	FrameOptions          string // X-Frame-Options
+	ReferrerPolicy        string // Referrer-Policy
+	PermissionsPolicy     string // Permissions-Policy
+	ContentSecurityPolicy string // Content-Security-Policy，其中的 {nonce} 会被替换成每个请求的 nonce
+	CSPReportOnly         bool   // 使用 Content-Security-Policy-Report-Only，只上报不拦截，方便上线前验证
+}
+
+// DefaultSecureConfig 返回默认的安全配置，HTTPS 相关的选项默认不开启
+func DefaultSecureConfig() SecureConfig {
+	return SecureConfig{
+		STSSeconds:         31536000,
+		ContentTypeOptions: "nosniff",
+		FrameOptions:       "DENY",
+		ReferrerPolicy:     "strict-origin-when-cross-origin",
+		PermissionsPolicy:  "camera=(), microphone=(), geolocation=()",
+		ContentSecurityPolicy: "default-src 'self'; script-src 'self' 'nonce-{nonce}'; style-src 'self' 'nonce-{nonce}'; " +
+			"object-src 'none'; base-uri 'self'; frame-ancestors 'none'",
+	}
+}
+
+// SecureFuncMap 返回 cspNonce 模板函数的占位实现，需要在 LoadHTMLGlob 之前通过 AddFuncMap 注册
+// 真正的实现由中间件在每个请求中通过 SetTemplateFunc 设置
+func SecureFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"cspNonce": func() string { return "" },
+	}
+}
+
+// CSPNonce 返回当前请求的 CSP nonce，没有使用安全中间件或者 CSP 中没有 {nonce} 时返回空字符串
+func (c *Context) CSPNonce() string {
+	return c.GetString(CSPNonceKey)
+}
+
+// MiddlewareSecure 使用默认配置的安全响应头中间件
+func MiddlewareSecure() HandlerFunc {
+	return MiddlewareSecureWithConfig(DefaultSecureConfig())
+}
+
+// MiddlewareSecureWithConfig 根据配置创建安全响应头中间件
+func MiddlewareSecureWithConfig(conf SecureConfig) HandlerFunc {
+	allowedHosts := make(map[string]bool, len(conf.AllowedHosts))
+	for _, host := range conf.AllowedHosts {
+		allowedHosts[strings.ToLower(host)] = true
+	}
+	sts := ""
+	if conf.STSSeconds > 0 {
+		sts = "max-age=" + strconv.Itoa(conf.STSSeconds)
+		if conf.STSIncludeSubdomains {
+			sts += "; includeSubDomains"
+		}
+		if conf.STSPreload {
+			sts += "; preload"
+		}
+	}
+	cspHeader := "Content-Security-Policy"
+	if conf.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+	useNonce := strings.Contains(conf.ContentSecurityPolicy, cspNoncePlaceholder)
+
+	return func(c *Context) {
+		if len(allowedHosts) > 0 && !allowedHosts[strings.ToLower(c.Req.Host)] && !allowedHosts[strings.ToLower(stripPort(c.Req.Host))] {
+			c.Abort()
+			c.Fail(http.StatusBadRequest, "Bad Host")
+			return
+		}
+		https := conf.isHTTPS(c.Req)
+		if conf.SSLRedirect && !https {
+			host := conf.SSLHost
+			if host == "" {
+				host = stripPort(c.Req.Host)
+			}
+			// GET 和 HEAD 以外的请求使用 308，浏览器重定向时不会改变请求方式和 body
+			code := http.StatusMovedPermanently
+			if c.Method != http.MethodGet && c.Method != http.MethodHead {
+				code = http.StatusPermanentRedirect
+			}
+			c.Abort()
+			http.Redirect(c.Writer, c.Req, "https://"+host+c.Req.URL.RequestURI(), code)
+			return
+		}
+
+		header := c.Writer.Header()
+		// HSTS 只能通过 HTTPS 下发，浏览器会忽略 HTTP 响应中的 HSTS
+		if sts != "" && https {
+			header.Set("Strict-Transport-Security", sts)
+		}
+		if conf.ContentTypeOptions != "" {
+			header.Set("X-Content-Type-Options", conf.ContentTypeOptions)
+		}
+		if conf.FrameOptions != "" {
+			header.Set("X-Frame-Options", conf.FrameOptions)
+		}
+		if conf.ReferrerPolicy != "" {
+			header.Set("Referrer-Policy", conf.ReferrerPolicy)
+		}
+		if conf.PermissionsPolicy != "" {
+			header.Set("Permissions-Policy", conf.PermissionsPolicy)
+		}
+		if conf.ContentSecurityPolicy != "" {
+			csp := conf.ContentSecurityPolicy
+			if useNonce {
+				nonce := base64.RawURLEncoding.EncodeToString(randomBytes(16))
+				csp = strings.ReplaceAll(csp, cspNoncePlaceholder, nonce)
+				c.Set(CSPNonceKey, nonce)
+				c.SetTemplateFunc("cspNonce", func() string { return nonce })
+			}
+			header.Set(cspHeader, csp)
+		}
+		c.Next()
+	}
+}
+
+// isHTTPS 判断原始请求是否是 HTTPS，TLS 在反向代理终结时通过 SSLProxyHeaders 判断
+func (conf *SecureConfig) isHTTPS(req *http.Request) bool {
+	return isHTTPSRequest(req, conf.SSLProxyHeaders)
+}
+
+// isHTTPSRequest 判断原始请求是否是 HTTPS，proxyHeaders 是反向代理设置的请求头和值，eg: {"X-Forwarded-Proto": "https"}
+// 这些请求头可以被客户端伪造，只应该在服务只能通过反向代理访问时设置
+func isHTTPSRequest(req *http.Request, proxyHeaders map[string]string) bool {
+	if req.TLS != nil {
+		return true
+	}
+	for name, value := range proxyHeaders {
+		if strings.EqualFold(req.Header.Get(name), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripPort 去掉 Host 中的端口，eg: example.com:8080 -> example.com
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
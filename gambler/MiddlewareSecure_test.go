@@ -0,0 +1,115 @@
+package gambler
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareSecureHeaders(t *testing.T) {
+	r := New()
+	r.UseMiddlewares(MiddlewareSecure())
+	r.GET("/", func(c *Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	header := w.Header()
+	if header.Get("X-Content-Type-Options") != "nosniff" || header.Get("X-Frame-Options") != "DENY" ||
+		header.Get("Referrer-Policy") == "" || header.Get("Permissions-Policy") == "" {
+		t.Fatalf("default headers missing: %v", header)
+	}
+	if header.Get("Strict-Transport-Security") != "" {
+		t.Fatal("HSTS should not be sent over plain HTTP")
+	}
+	if strings.Contains(header.Get("Content-Security-Policy"), "{nonce}") {
+		t.Fatalf("nonce placeholder should be replaced, got %s", header.Get("Content-Security-Policy"))
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Header().Get("Strict-Transport-Security") != "max-age=31536000" {
+		t.Fatalf("HSTS should be sent over HTTPS, got %q", w.Header().Get("Strict-Transport-Security"))
+	}
+}
+
+func TestMiddlewareSecureNonce(t *testing.T) {
+	dir := t.TempDir()
+	page := `<script nonce="{{ cspNonce }}"></script>`
+	if err := os.WriteFile(filepath.Join(dir, "page.tmpl"), []byte(page), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r := New()
+	r.SetFuncMap(SecureFuncMap())
+	r.LoadHTMLGlob(filepath.Join(dir, "*"))
+	r.UseMiddlewares(MiddlewareSecure())
+	r.GET("/", func(c *Context) {
+		c.HTML(http.StatusOK, "page.tmpl", nil)
+	})
+
+	nonces := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		match := regexp.MustCompile(`nonce="([^"]+)"`).FindStringSubmatch(w.Body.String())
+		if match == nil {
+			t.Fatalf("page should contain nonce, got %s", w.Body.String())
+		}
+		if !strings.Contains(w.Header().Get("Content-Security-Policy"), "'nonce-"+match[1]+"'") {
+			t.Fatalf("CSP should contain the rendered nonce %s, got %s", match[1], w.Header().Get("Content-Security-Policy"))
+		}
+		nonces[match[1]] = true
+	}
+	if len(nonces) != 2 {
+		t.Fatal("nonce should be different for every request")
+	}
+}
+
+func TestMiddlewareSecureRedirect(t *testing.T) {
+	r := New()
+	r.UseMiddlewares(MiddlewareSecureWithConfig(SecureConfig{
+		AllowedHosts:    []string{"example.com"},
+		SSLRedirect:     true,
+		SSLProxyHeaders: map[string]string{"X-Forwarded-Proto": "https"},
+	}))
+	r.GET("/", func(c *Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	r.POST("/", func(c *Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "http://evil.com/", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown host should be rejected, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com:8080/?a=1", nil))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "https://example.com/?a=1" {
+		t.Fatalf("should redirect to https, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "http://example.com/", nil))
+	if w.Code != http.StatusPermanentRedirect {
+		t.Fatalf("POST should be redirected with 308, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("request behind TLS proxy should not be redirected, got %d", w.Code)
+	}
+}
@@ -0,0 +1,207 @@
+package gambler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MiddlewareTimeout.go: 超时中间件，给后面的中间件和 handler 设置一个截止时间
+// 剩下的 handlers 会在新的 goroutine 中使用 Context 的副本执行，响应先写到缓冲区里
+// 在截止时间前执行完成就把缓冲区写出，否则直接返回 503，handler 之后的写入都会返回 http.ErrHandlerTimeout
+//
+// 注意：超时后 handler 所在的 goroutine 不会被强制结束，handler 应该通过 c.Req.Context().Done() 感知超时并尽快返回
+// 超时后 handler 手上的 Context 是副本，对它的修改不会影响原来的 Context，但也不要再把它交给其他 goroutine 长期持有
+// 由于响应是缓冲的，超时中间件后面的 handler 不支持 Flush 流式输出
+
+// TimeoutConfig 超时中间件的配置
+type TimeoutConfig struct {
+	Timeout time.Duration // 超时时间
+	Handler HandlerFunc   // 超时后的响应，默认返回 503
+}
+
+// MiddlewareTimeout 创建超时中间件，超时后返回 503
+func MiddlewareTimeout(timeout time.Duration) HandlerFunc {
+	return MiddlewareTimeoutWithConfig(TimeoutConfig{Timeout: timeout})
+}
+
+// MiddlewareTimeoutWithConfig 根据配置创建超时中间件
+func MiddlewareTimeoutWithConfig(conf TimeoutConfig) HandlerFunc {
+	if conf.Handler == nil {
+		conf.Handler = func(c *Context) {
+			c.Fail(http.StatusServiceUnavailable, "Service Unavailable")
+		}
+	}
+	return func(c *Context) {
+		if conf.Timeout <= 0 {
+			c.Next()
+			return
+		}
+		// 不能直接使用 context.WithTimeout：handler 可能先于这里感知到超时并继续写入，必须先标记超时再取消
+		ctx := newTimeoutContext(c.Req.Context(), conf.Timeout)
+		defer ctx.cancel()
+		timer := time.NewTimer(conf.Timeout)
+		defer timer.Stop()
+
+		tw := &timeoutWriter{header: make(http.Header)}
+		// 剩下的 handlers 交给副本执行，原来的 Context 只在当前 goroutine 中使用
+		cc := c.copy()
+		cc.Req = c.Req.WithContext(ctx)
+		cc.resp = newResponseWriter(tw)
+		cc.Writer = cc.resp
+		done := make(chan struct{})
+		panicChan := make(chan *handlerPanic, 1)
+		go func() {
+			defer func() {
+				if err := recover(); err != nil {
+					p := &handlerPanic{value: err, stack: debug.Stack()}
+					tw.mu.Lock()
+					defer tw.mu.Unlock()
+					if tw.timedOut {
+						// 已经超时，外层不会再处理，只记录日志
+						cc.Logger().Error("panic after timeout", F("method", cc.Method), F("path", cc.Path), F("panic", p.String()))
+						return
+					}
+					panicChan <- p
+				}
+			}()
+			cc.Next()
+			close(done)
+		}()
+
+		select {
+		case p := <-panicChan:
+			// 交给外层的 MiddlewareRecover 处理，http.ErrAbortHandler 原样抛出，保证 net/http 能够识别
+			c.Abort()
+			if p.value == http.ErrAbortHandler {
+				panic(p.value)
+			}
+			panic(p)
+		case <-done:
+			c.Abort()
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			c.StatusCode = cc.StatusCode
+			c.Params = cc.Params
+			cc.keysMu.RLock()
+			for k, v := range cc.keys {
+				c.Set(k, v)
+			}
+			cc.keysMu.RUnlock()
+			c.funcs = cc.funcs
+			header := c.Writer.Header()
+			for k, v := range tw.header {
+				header[k] = v
+			}
+			if tw.wroteHeader {
+				c.Writer.WriteHeader(tw.status)
+			}
+			if tw.buf.Len() > 0 {
+				c.Writer.Write(tw.buf.Bytes())
+			}
+		case <-timer.C:
+			tw.mu.Lock()
+			tw.timedOut = true
+			tw.mu.Unlock()
+			// 超时的同时发生了 panic，select 选中了超时，panic 只记录日志
+			select {
+			case p := <-panicChan:
+				c.Logger().Error("panic after timeout", F("method", c.Method), F("path", c.Path), F("panic", p.String()))
+			default:
+			}
+			ctx.expire()
+			c.Logger().Warn("handler timeout", F("method", c.Method), F("path", c.Path), F("timeout", conf.Timeout))
+			c.Abort()
+			conf.Handler(c)
+		}
+	}
+}
+
+// handlerPanic 超时中间件在 handler 所在的 goroutine 中恢复的 panic，重新抛出时带上原来的值和 handler 的堆栈
+// MiddlewareRecover 会取出原来的值，保证 http.ErrAbortHandler 和断开连接的错误能够被识别
+type handlerPanic struct {
+	value interface{}
+	stack []byte
+}
+
+// String 没有 MiddlewareRecover 时由 net/http 输出到日志
+func (p *handlerPanic) String() string {
+	return fmt.Sprintf("%v\n%s", p.value, p.stack)
+}
+
+// timeoutContext 超时中间件传给 handler 的 context，Deadline 返回截止时间，由中间件在标记超时后再取消
+type timeoutContext struct {
+	context.Context
+	cancel   context.CancelFunc
+	deadline time.Time
+	expired  int32 // 1 表示是因为超时而取消的
+}
+
+func newTimeoutContext(parent context.Context, timeout time.Duration) *timeoutContext {
+	ctx, cancel := context.WithCancel(parent)
+	deadline := time.Now().Add(timeout)
+	if d, ok := parent.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	return &timeoutContext{Context: ctx, cancel: cancel, deadline: deadline}
+}
+
+// expire 标记超时并取消
+func (ctx *timeoutContext) expire() {
+	atomic.StoreInt32(&ctx.expired, 1)
+	ctx.cancel()
+}
+
+func (ctx *timeoutContext) Deadline() (time.Time, bool) {
+	return ctx.deadline, true
+}
+
+// Err 因为超时而取消时返回 context.DeadlineExceeded，和 context.WithTimeout 保持一致
+func (ctx *timeoutContext) Err() error {
+	err := ctx.Context.Err()
+	if err != nil && atomic.LoadInt32(&ctx.expired) == 1 {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// timeoutWriter 缓存 handler 写出的响应头和响应体，超时后拒绝写入
+type timeoutWriter struct {
+	mu          sync.Mutex
+	header      http.Header
+	buf         bytes.Buffer
+	status      int
+	wroteHeader bool
+	timedOut    bool
+}
+
+// Header 返回独立的响应头，超时后 handler 修改它也不会影响真正的响应
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = http.StatusOK, true
+	}
+	return w.buf.Write(data)
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut || w.wroteHeader {
+		return
+	}
+	w.status, w.wroteHeader = code, true
+}
@@ -0,0 +1,153 @@
+package gambler
+
+import (
+	"errors"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestMiddlewareTimeout(t *testing.T) {
+	r := New()
+	r.UseMiddlewares(MiddlewareTimeout(50 * time.Millisecond))
+	finished := make(chan error, 1)
+	r.GET("/slow", func(c *Context) {
+		select {
+		case <-c.Req.Context().Done():
+		case <-time.After(time.Second):
+		}
+		// 超时后的写入会被拒绝
+		_, err := c.Writer.Write([]byte("too late"))
+		finished <- err
+	})
+	r.GET("/fast", func(c *Context) {
+		c.SetHeader("X-Fast", "1")
+		c.String(http.StatusCreated, "fast")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/slow", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("slow handler should time out, got %d", w.Code)
+	}
+	if err := <-finished; err != http.ErrHandlerTimeout {
+		t.Fatalf("write after timeout should fail with ErrHandlerTimeout, got %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/fast", nil))
+	if w.Code != http.StatusCreated || w.Body.String() != "fast" || w.Header().Get("X-Fast") != "1" {
+		t.Fatalf("fast handler response should be kept, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestMiddlewareTimeoutPanic(t *testing.T) {
+	r := New()
+	r.UseMiddlewares(MiddlewareRecover(), MiddlewareTimeout(time.Second))
+	r.GET("/panic", func(c *Context) {
+		panic("boom")
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("panic in handler should be recovered, got %d", w.Code)
+	}
+}
+
+func TestMiddlewareTimeoutPanicValue(t *testing.T) {
+	var got interface{}
+	r := New()
+	r.UseMiddlewares(MiddlewareRecoverWithConfig(RecoveryConfig{
+		Output: io.Discard,
+		Handler: func(c *Context, err interface{}) {
+			got = err
+			c.Fail(http.StatusInternalServerError, "Internal Server Error")
+		},
+	}), MiddlewareTimeout(time.Second))
+	broken := &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}
+	r.GET("/broken", func(c *Context) {
+		panic(broken)
+	})
+	r.GET("/error", func(c *Context) {
+		panic(errors.New("boom"))
+	})
+	r.GET("/abort", func(c *Context) {
+		panic(http.ErrAbortHandler)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/broken", nil))
+	if w.Body.Len() != 0 || got != nil {
+		t.Fatalf("broken pipe inside timeout should be detected, got %d %q %v", w.Code, w.Body.String(), got)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/error", nil))
+	if err, ok := got.(error); !ok || err.Error() != "boom" || w.Code != http.StatusInternalServerError {
+		t.Fatalf("recovery handler should get the original panic value, got %#v", got)
+	}
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Fatalf("http.ErrAbortHandler inside timeout should be re-panicked, got %v", err)
+		}
+	}()
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/abort", nil))
+}
+
+// logChan 把每一行日志发送到 channel，测试中等待其他 goroutine 的日志
+type logChan chan string
+
+func (ch logChan) Write(p []byte) (int, error) {
+	ch <- string(p)
+	return len(p), nil
+}
+
+func TestMiddlewareTimeoutAbandonedHandler(t *testing.T) {
+	logs := make(logChan, 16)
+	r := New()
+	r.SetLogger(NewLogger(logs, LevelError))
+	r.SetFuncMap(template.FuncMap{"name": func() string { return "" }})
+	r.LoadHTMLFS(fstest.MapFS{"page.tmpl": {Data: []byte(`{{ name }}`)}}, "*.tmpl")
+	r.UseMiddlewares(func(c *Context) {
+		c.SetTemplateFunc("name", func() string { return "timeout" })
+		c.Next()
+	}, MiddlewareTimeoutWithConfig(TimeoutConfig{
+		Timeout: 20 * time.Millisecond,
+		Handler: func(c *Context) {
+			c.HTML(http.StatusServiceUnavailable, "page.tmpl", nil)
+		},
+	}))
+	r.GET("/slow/:id", func(c *Context) {
+		<-c.Req.Context().Done()
+		// 超时后被丢弃的 handler 继续修改自己的 Context，不能影响外层的响应
+		for i := 0; i < 100; i++ {
+			c.SetTemplateFunc("name", func() string { return "late" })
+			c.Params["id"] = "late"
+			c.Writer.Write([]byte("late"))
+		}
+		panic("late panic")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/slow/1", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "timeout" {
+		t.Fatalf("timeout response should be rendered, got %d %q", w.Code, w.Body.String())
+	}
+	select {
+	case line := <-logs:
+		if !strings.Contains(line, "panic after timeout") || !strings.Contains(line, "late panic") {
+			t.Fatalf("unexpected log %q", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("panic after timeout should be logged")
+	}
+}
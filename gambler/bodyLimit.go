@@ -0,0 +1,97 @@
+package gambler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// bodyLimit.go: 限制请求 body 的大小，防止客户端上传超大的 body 耗尽内存，eg: handler 调用 PostForm 时会把整个表单读进内存
+// 可以通过 SetMaxBodySize 在 Engine 上设置全局的限制，也可以在分组上单独设置，匹配到的前缀最长的分组的限制生效
+// 限制在所有中间件之前生效，Content-Length 超过限制时中间件仍然会执行，但是读取 body 会失败，最后返回 413，不会执行 handler
+// 没有 Content-Length(分块传输)时，读取超过限制返回 ErrBodyTooLarge，PostForm 会返回 413，直接读取 body 时需要调用 AbortBodyTooLarge
+
+// ErrBodyTooLarge 读取的请求 body 超过限制
+var ErrBodyTooLarge = errors.New("gambler: request body too large")
+
+// SetMaxBodySize 设置分组(包括 Engine)的请求 body 大小限制，单位是字节
+// 为 0 时使用上层分组的限制，小于 0 时不限制，eg: 上传接口所在的分组可以放开 Engine 的全局限制
+func (group *RouterGroup) SetMaxBodySize(n int64) {
+	group.maxBodySize = n
+	group.engine.logger.Debug("max body size set", F("group", group.prefix), F("bytes", n))
+}
+
+// limitBody 在所有中间件之前限制请求 body，中间件(eg: 从表单中获取 API Key)读取 body 时同样受到限制
+// 返回 Content-Length 是否已经超过限制，超过时 body 不会再被读取，第一次读取就返回 ErrBodyTooLarge
+func (c *Context) limitBody(w http.ResponseWriter, limit int64) bool {
+	if c.Req.Body == nil || c.Req.Body == http.NoBody {
+		return false
+	}
+	if c.Req.ContentLength > limit {
+		c.Req.Body = &limitedBody{ReadCloser: c.Req.Body, limit: limit, exceeded: 1}
+		return true
+	}
+	// MaxBytesReader 需要原始的 ResponseWriter，超过限制时通知 http.Server 关闭连接
+	c.Req.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, c.Req.Body, limit), limit: limit}
+	return false
+}
+
+// abortBodyTooLarge Content-Length 超过限制时放在分组中间件的最后，代替 handler 返回 413
+// 访问日志、请求 ID、CORS 等中间件仍然会执行，浏览器跨域上传时也能拿到可读的 413
+func abortBodyTooLarge(c *Context) {
+	c.AbortBodyTooLarge()
+}
+
+// AbortBodyTooLarge 返回 413 并终止后续的 handler，之后的写入都会被丢弃，保证客户端收到的是完整的 413 响应
+// 读取 body 返回 ErrBodyTooLarge 时调用，PostForm 会自动调用；直接读取 c.Req.Body 的 handler 需要自己调用
+// 413 写到调用者的 Context 中，eg: 超时中间件中的 handler 写到自己的缓冲区中，由超时中间件输出
+func (c *Context) AbortBodyTooLarge() {
+	c.Abort()
+	if c.resp.Written() {
+		return
+	}
+	// 剩下的 body 不会再读取，不能复用连接
+	c.SetHeader("Connection", "close")
+	c.Fail(http.StatusRequestEntityTooLarge, "Request Entity Too Large")
+	c.Writer = discardWriter{c.Writer}
+}
+
+// bodyExceeded 读取请求 body 时是否超过了限制
+func (c *Context) bodyExceeded() bool {
+	b, ok := c.Req.Body.(*limitedBody)
+	return ok && atomic.LoadInt32(&b.exceeded) == 1
+}
+
+// limitedBody 包装 http.MaxBytesReader，超过限制时返回的错误同时匹配 ErrBodyTooLarge 和 *http.MaxBytesError
+// 它不持有 Context，body 可能在其他 goroutine 中读取(eg: 超时中间件)，响应由读取者的 Context 写出
+type limitedBody struct {
+	io.ReadCloser
+	limit    int64
+	exceeded int32 // 1 表示超过了限制，之后的读取都返回错误
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if atomic.LoadInt32(&b.exceeded) == 1 {
+		return 0, fmt.Errorf("%w: %w", ErrBodyTooLarge, &http.MaxBytesError{Limit: b.limit})
+	}
+	n, err := b.ReadCloser.Read(p)
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		atomic.StoreInt32(&b.exceeded, 1)
+		return n, fmt.Errorf("%w: %w", ErrBodyTooLarge, err)
+	}
+	return n, err
+}
+
+// discardWriter 丢弃所有的写入，只保留 Header 方法
+type discardWriter struct {
+	http.ResponseWriter
+}
+
+func (discardWriter) WriteHeader(int) {}
+
+func (discardWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
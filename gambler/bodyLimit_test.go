@@ -0,0 +1,154 @@
+package gambler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newBodyLimitTestEngine() *Engine {
+	r := New()
+	r.SetMaxBodySize(16)
+	handler := func(c *Context) {
+		c.String(http.StatusOK, "name=%s", c.PostForm("name"))
+	}
+	r.POST("/form", handler)
+	upload := r.NewGroup("/upload")
+	upload.SetMaxBodySize(-1)
+	upload.POST("/form", handler)
+	return r
+}
+
+func postForm(r *Engine, path string, value string, chunked bool) *httptest.ResponseRecorder {
+	body := url.Values{"name": {value}}.Encode()
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if chunked {
+		// 去掉 Content-Length，只能在读取时发现超过限制
+		req.ContentLength = -1
+		req.Body = io.NopCloser(strings.NewReader(body))
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestMaxBodySize(t *testing.T) {
+	r := newBodyLimitTestEngine()
+	for _, chunked := range []bool{false, true} {
+		if w := postForm(r, "/form", "liup", chunked); w.Code != http.StatusOK || w.Body.String() != "name=liup" {
+			t.Fatalf("small body should pass, got %d %s", w.Code, w.Body.String())
+		}
+		w := postForm(r, "/form", strings.Repeat("a", 32), chunked)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("chunked=%v: large body should get 413, got %d", chunked, w.Code)
+		}
+		if strings.Contains(w.Body.String(), "name=") {
+			t.Fatalf("handler output should be discarded after 413, got %s", w.Body.String())
+		}
+		if w := postForm(r, "/upload/form", strings.Repeat("a", 32), chunked); w.Code != http.StatusOK {
+			t.Fatalf("group without limit should pass, got %d", w.Code)
+		}
+	}
+}
+
+func TestLimitedBodyExact(t *testing.T) {
+	w := httptest.NewRecorder()
+	c := newContext(w, httptest.NewRequest("POST", "/", io.NopCloser(strings.NewReader("12345"))))
+	if c.limitBody(w, 5) {
+		t.Fatal("body without Content-Length should not be rejected up front")
+	}
+	data, err := io.ReadAll(c.Req.Body)
+	if err != nil || string(data) != "12345" {
+		t.Fatalf("body equal to the limit should be read, got %q %v", data, err)
+	}
+}
+
+func TestMaxBodySizeBeforeMiddlewares(t *testing.T) {
+	r := New()
+	r.SetLogger(nil)
+	api := r.NewGroup("/api")
+	api.SetMaxBodySize(16)
+	validated := false
+	api.UseMiddlewares(MiddlewareAPIKeyWithConfig(APIKeyConfig{
+		Lookup: "form:name",
+		Validator: func(c *Context, key string) (interface{}, bool) {
+			validated = true
+			return key, true
+		},
+	}))
+	api.POST("/form", func(c *Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	for _, chunked := range []bool{false, true} {
+		validated = false
+		w := postForm(r, "/api/form", strings.Repeat("a", 32), chunked)
+		if w.Code != http.StatusRequestEntityTooLarge || strings.Contains(w.Body.String(), "ok") {
+			t.Fatalf("chunked=%v: middleware reading the form should get 413, got %d %s", chunked, w.Code, w.Body.String())
+		}
+		if validated {
+			t.Fatalf("chunked=%v: validator should not see an oversized body", chunked)
+		}
+	}
+}
+
+func TestMaxBodySizeWithTimeout(t *testing.T) {
+	r := New()
+	r.SetLogger(nil)
+	r.SetMaxBodySize(16)
+	r.UseMiddlewares(MiddlewareTimeout(time.Second))
+	r.POST("/form", func(c *Context) {
+		c.String(http.StatusOK, "name=%s", c.PostForm("name"))
+	})
+	r.POST("/raw", func(c *Context) {
+		if _, err := io.ReadAll(c.Req.Body); errors.Is(err, ErrBodyTooLarge) {
+			c.AbortBodyTooLarge()
+			return
+		}
+		c.String(http.StatusOK, "ok")
+	})
+	for _, path := range []string{"/form", "/raw"} {
+		w := postForm(r, path, strings.Repeat("a", 32), true)
+		if w.Code != http.StatusRequestEntityTooLarge || strings.Contains(w.Body.String(), "name=") {
+			t.Fatalf("%s: large body read under timeout should get 413, got %d %q", path, w.Code, w.Body.String())
+		}
+		if w.Header().Get("Connection") != "close" {
+			t.Fatalf("%s: connection should be closed after 413, got %v", path, w.Header())
+		}
+	}
+	if w := postForm(r, "/form", "liup", true); w.Code != http.StatusOK || w.Body.String() != "name=liup" {
+		t.Fatalf("small body should pass, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestMaxBodySizeRunsMiddlewares(t *testing.T) {
+	var buf bytes.Buffer
+	r := New()
+	r.SetLogger(nil)
+	r.SetMaxBodySize(16)
+	r.UseMiddlewares(MiddlewareLoggerWithConfig(LoggerConfig{Format: "${status}", Output: &buf}),
+		MiddlewareRequestID(), MiddlewareCORS())
+	handled := false
+	r.POST("/form", func(c *Context) {
+		handled = true
+	})
+	req := httptest.NewRequest("POST", "/form", strings.NewReader(strings.Repeat("a", 32)))
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge || handled {
+		t.Fatalf("declared large body should get 413 without the handler, got %d handled=%v", w.Code, handled)
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") == "" || w.Header().Get("X-Request-ID") == "" {
+		t.Fatalf("middlewares should still run for 413, got %v", w.Header())
+	}
+	if buf.String() != "413\n" {
+		t.Fatalf("413 should be logged, got %q", buf.String())
+	}
+}
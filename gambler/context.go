@@ -1,10 +1,15 @@
 package gambler
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"log"
+	"html/template"
+	"math"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
 )
 
 // context.go: 封装*http.Request和http.ResponseWriter的方法，简化相关接口的调用，只是设计 Context 的原因之一
@@ -18,22 +23,30 @@ type JsonMap map[string]interface{}
 // Context 构建上下文的字段
 type Context struct {
 	// 原始字段
-	Writer     http.ResponseWriter
-	Req        *http.Request
-	Path       string            // req 请求信息
-	Method     string            // req 请求信息
-	StatusCode int               // resp 响应信息
-	Params     map[string]string // 保存解析后的参数
-	handlers   []HandlerFunc     // 中间件部分：这个列表中表示里面的 handler 可能会结合中间件进行处理
-	index      int               // 中间件部分：表示执行到了第几个中间件
-	engine     *Engine           // 用于能够通过 Context 来访问 engine 的 HTML 模板，在实例化的时候需要给 engine 赋值
+	Writer       http.ResponseWriter
+	Req          *http.Request
+	Path         string                 // req 请求信息
+	Method       string                 // req 请求信息
+	StatusCode   int                    // resp 响应信息
+	Params       map[string]string      // 保存解析后的参数
+	fullPath     string                 // 匹配到的路由，eg: /hello/:name，没有匹配到时为空
+	handlers     []HandlerFunc          // 中间件部分：这个列表中表示里面的 handler 可能会结合中间件进行处理
+	index        int                    // 中间件部分：表示执行到了第几个中间件
+	engine       *Engine                // 用于能够通过 Context 来访问 engine 的 HTML 模板，在实例化的时候需要给 engine 赋值
+	resp         *responseWriter        // 记录真正写出的状态码和字节数，Writer 被中间件替换后仍然可以通过它拿到
+	keys         map[string]interface{} // 中间件之间传递数据，eg: 请求 ID、认证后的用户
+	keysMu       sync.RWMutex           // handler 可能在其他 goroutine 中访问 keys
+	logger       Logger                 // 请求级别的 Logger，为空时使用 engine 的 Logger
+	funcs        template.FuncMap       // 请求级别的模板函数，eg: csrfToken，渲染时覆盖 engine 的同名函数
+	htmlRenderer HTMLRenderer           // 匹配到的分组的渲染引擎，为空时使用 engine 加载的模板
 }
 
 // newContext 创建新的 context
 func newContext(w http.ResponseWriter, req *http.Request) *Context {
-	log.Printf("Debug msg : context.go -> newContext : create context\n")
+	resp := newResponseWriter(w)
 	return &Context{
-		Writer: w,
+		Writer: resp,
+		resp:   resp,
 		Req:    req,
 		Path:   req.URL.Path,
 		Method: req.Method,
@@ -41,12 +54,52 @@ func newContext(w http.ResponseWriter, req *http.Request) *Context {
 	}
 }
 
+// copy 复制一个 Context 交给其他 goroutine 使用，keys、Params 和 funcs 会复制一份，避免两个 goroutine 并发读写同一个 map
+// 副本有自己的 resp，记录的状态和原来的一样，之后的写入不会修改原来的 Context 的记录
+func (c *Context) copy() *Context {
+	resp := &responseWriter{ResponseWriter: c.Writer, status: c.resp.status, size: c.resp.size, wroteHeader: c.resp.wroteHeader}
+	cp := &Context{
+		Writer:       resp,
+		Req:          c.Req,
+		Path:         c.Path,
+		Method:       c.Method,
+		StatusCode:   c.StatusCode,
+		fullPath:     c.fullPath,
+		handlers:     c.handlers,
+		index:        c.index,
+		engine:       c.engine,
+		resp:         resp,
+		logger:       c.logger,
+		htmlRenderer: c.htmlRenderer,
+	}
+	if c.Params != nil {
+		cp.Params = make(map[string]string, len(c.Params))
+		for k, v := range c.Params {
+			cp.Params[k] = v
+		}
+	}
+	if c.funcs != nil {
+		cp.funcs = make(template.FuncMap, len(c.funcs))
+		for name, fn := range c.funcs {
+			cp.funcs[name] = fn
+		}
+	}
+	c.keysMu.RLock()
+	if c.keys != nil {
+		cp.keys = make(map[string]interface{}, len(c.keys))
+		for k, v := range c.keys {
+			cp.keys[k] = v
+		}
+	}
+	c.keysMu.RUnlock()
+	return cp
+}
+
 // Next 用于切换中间件，在中间件调用该方法时将会把控制权交给下一个中间件，直到最后一个中间件，然后在从后往前调用每个中间件在 next 之后的部分
 func (c *Context) Next() {
 	c.index++
 	num := len(c.handlers)
 	for ; c.index < num; c.index++ {
-		log.Printf("Debug msg : context.go -> Next : change next in []HandlerFunc, index = %d, num of handlers = %d\n", c.index, num)
 		// 切换中间件的控制，参考匿名函数的执行
 		// 匿名函数的最后传入参数就代表执行
 		c.handlers[c.index](c)
@@ -54,16 +107,19 @@ func (c *Context) Next() {
 }
 
 // PostForm Tip：net/http包下 Request.FormValue 方法 可以额获取 url 中? 后面的请求参数，或者是已解析的表单数据
-// PostForm 封装 FromValue 方法,获取表单中指定 key 的值
+// PostForm 封装 FromValue 方法,获取表单中指定 key 的值，表单超过 SetMaxBodySize 的限制时返回 413 并终止后续的 handler
 func (c *Context) PostForm(key string) string {
-	log.Printf("Debug msg : context.go -> PostForm : key = %s, value = %s \n", key, c.Req.FormValue(key))
-	return c.Req.FormValue(key)
+	value := c.Req.FormValue(key)
+	// 表单超过了 body 大小限制，返回 413
+	if c.bodyExceeded() {
+		c.AbortBodyTooLarge()
+	}
+	return value
 }
 
 // Query Tip：Req.URL.Query().Get(key) 可以额获取 url 中? 后面的请求参数，一般是 GET 方法常用
 // Query 通过 key 获取 URL 中的对应的查询参数值
 func (c *Context) Query(key string) string {
-	log.Printf("Debug msg : context.go -> Query : key = %s, value = %s \n", key, c.Req.URL.Query().Get(key))
 	return c.Req.URL.Query().Get(key)
 }
 
@@ -71,7 +127,6 @@ func (c *Context) Query(key string) string {
 func (c *Context) SetStatus(code int) {
 	c.StatusCode = code
 	c.Writer.WriteHeader(code)
-	log.Printf("Debug msg : context.go -> SetStatus : code = %v\n", c.StatusCode)
 }
 
 // SetHeader 设置 Header, 例子如下
@@ -79,7 +134,6 @@ func (c *Context) SetStatus(code int) {
 // Header["User-Agent"] = ["Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/111.0.0.0 Safari/537.36"]
 func (c *Context) SetHeader(key string, value string) {
 	c.Writer.Header().Set(key, value)
-	log.Printf("Debug msg : context.go -> SetHeader : key = %s, value = %s \n", key, value)
 }
 
 // String 构造 string 类型响应的方法，其中 ... 表示可以接受任意数量的接口类型
@@ -91,7 +145,6 @@ func (c *Context) String(code int, format string, value ...interface{}) {
 	// 第一个用法主要是用于函数有多个不定参数的情况，表示为可变参数，可以接受任意个数但相同类型的参数
 	// 第二个用法是slice可以被打散进行传递
 	c.Writer.Write([]byte(fmt.Sprintf(format, value...)))
-	log.Printf("Debug msg : context.go -> String : write content = %s", []byte(fmt.Sprintf(format, value...)))
 }
 
 // JSON 构造 JSON 类型响应的方法，接口类型可以表示任意值
@@ -99,7 +152,6 @@ func (c *Context) JSON(code int, obj interface{}) {
 	c.SetHeader("Content_type", "application/json")
 	c.SetStatus(code)
 	encoder := json.NewEncoder(c.Writer)
-	log.Printf("Debug msg : context.go -> JSON : finish\n")
 	if err := encoder.Encode(obj); err != nil {
 		http.Error(c.Writer, err.Error(), 500)
 	}
@@ -109,29 +161,143 @@ func (c *Context) JSON(code int, obj interface{}) {
 func (c *Context) Data(code int, data []byte) {
 	c.SetStatus(code)
 	c.Writer.Write(data)
-	log.Printf("Debug msg : context.go -> Data : data = %v\n", data)
 }
 
 // HTML 构造 HTML 类型的响应方法，接口类型可以表示任意值, 可以根据模板文件名选择模板进行渲染
+// 通过 LoadHTMLLayouts 加载的页面会套上默认的布局
 func (c *Context) HTML(code int, name string, data interface{}) {
+	c.renderHTML(code, name, data, HTMLRenderOptions{})
+}
+
+// HTMLWithLayout 使用指定的布局渲染页面，layout 为空时不使用布局，直接渲染页面
+func (c *Context) HTMLWithLayout(code int, layout string, page string, data interface{}) {
+	c.renderHTML(code, page, data, HTMLRenderOptions{Layout: layout, OverrideLayout: true})
+}
+
+// renderHTML 渲染页面，先渲染到缓冲区，渲染失败时可以返回完整的 500 响应，而不是渲染了一半的页面
+func (c *Context) renderHTML(code int, page string, data interface{}, opts HTMLRenderOptions) {
+	renderer := c.htmlRenderer
+	if renderer == nil {
+		renderer = engineRenderer{engine: c.engine}
+	}
+	opts.Funcs = c.funcs
+	var buf bytes.Buffer
+	if err := renderer.Render(&buf, page, data, opts); err != nil {
+		c.templateError(err)
+		return
+	}
 	c.SetHeader("Content-Type", "text/html")
 	c.SetStatus(code)
-	log.Printf("Debug msg : context.go -> HTML : template name = %s\n", name)
 	//c.Writer.Write([]byte(name)) // 被 ExecuteTemplate 代替
-	if err := c.engine.htmlTemplates.ExecuteTemplate(c.Writer, name, data); err != nil {
-		c.Fail(http.StatusInternalServerError, err.Error())
+	c.Writer.Write(buf.Bytes())
+}
+
+// SetTemplateFunc 设置只在当前请求中生效的模板函数，模板中使用的函数名需要先通过 SetFuncMap 或者 AddFuncMap 注册，否则模板解析失败
+// 有请求级别的函数时渲染使用模板的副本，副本按照函数名的组合缓存，每种组合第一次渲染时需要 Clone 并重新转义模板
+func (c *Context) SetTemplateFunc(name string, fn interface{}) {
+	if c.funcs == nil {
+		c.funcs = make(template.FuncMap)
 	}
+	c.funcs[name] = fn
+}
+
+// FullPath 返回匹配到的路由，eg: 请求 /hello/liup2 返回 /hello/:name，没有匹配到路由时返回空字符串
+func (c *Context) FullPath() string {
+	return c.fullPath
 }
 
 // GetParam 提供获取到url中 key 对应的值的方法
 func (c *Context) GetParam(key string) string {
 	value, _ := c.Params[key]
-	log.Printf("Debug msg : context.go -> GetParam : value = %v\n", value)
 	return value
 }
 
 // Fail 错误信息反馈
 func (c *Context) Fail(code int, err string) {
-	c.index = len(c.handlers)
+	c.Abort()
 	c.JSON(code, JsonMap{"message": err})
 }
+
+// abortIndex Abort 之后 index 的值，远大于 handlers 的数量，用来和正常执行结束区分
+const abortIndex = math.MaxInt / 2
+
+// Abort 终止后续的中间件和 handler，已经在执行的中间件在 Next 返回后仍会继续执行
+func (c *Context) Abort() {
+	c.index = abortIndex
+}
+
+// IsAborted 是否已经调用了 Abort，所有的 handler 正常执行结束时返回 false
+func (c *Context) IsAborted() bool {
+	return c.index >= abortIndex
+}
+
+// Set 在 Context 中保存一个值，供后面的中间件和 handler 使用
+func (c *Context) Set(key string, value interface{}) {
+	c.keysMu.Lock()
+	if c.keys == nil {
+		c.keys = make(map[string]interface{})
+	}
+	c.keys[key] = value
+	c.keysMu.Unlock()
+}
+
+// Get 获取 Set 保存的值
+func (c *Context) Get(key string) (value interface{}, exists bool) {
+	c.keysMu.RLock()
+	value, exists = c.keys[key]
+	c.keysMu.RUnlock()
+	return
+}
+
+// GetString 获取 Set 保存的字符串，不存在或者类型不对时返回空字符串
+func (c *Context) GetString(key string) string {
+	value, _ := c.Get(key)
+	s, _ := value.(string)
+	return s
+}
+
+// RequestID 返回 MiddlewareRequestID 为当前请求设置的 ID
+func (c *Context) RequestID() string {
+	return c.GetString(RequestIDKey)
+}
+
+// Logger 返回框架的 Logger，handler 和中间件通过它输出日志
+// 使用了 MiddlewareRequestID 时，返回的 Logger 会带上 request_id 字段
+func (c *Context) Logger() Logger {
+	if c.logger != nil {
+		return c.logger
+	}
+	if c.engine == nil {
+		return nopLogger{}
+	}
+	return c.engine.logger
+}
+
+// ClientIP 返回客户端的 IP
+// 只有当直接连接的对端是 SetTrustedProxies 中配置的代理时，才会从 X-Forwarded-For 和 X-Real-IP 中解析，防止客户端伪造
+func (c *Context) ClientIP() string {
+	remoteIP, _, err := net.SplitHostPort(strings.TrimSpace(c.Req.RemoteAddr))
+	if err != nil {
+		remoteIP = strings.TrimSpace(c.Req.RemoteAddr)
+	}
+	if c.engine == nil || !c.engine.isTrustedProxy(remoteIP) {
+		return remoteIP
+	}
+	// X-Forwarded-For: client, proxy1, proxy2 从右往左找到第一个不是可信代理的地址
+	if forwarded := c.Req.Header.Get("X-Forwarded-For"); forwarded != "" {
+		ips := strings.Split(forwarded, ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(ips[i])
+			if net.ParseIP(ip) == nil {
+				break
+			}
+			if i == 0 || !c.engine.isTrustedProxy(ip) {
+				return ip
+			}
+		}
+	}
+	if realIP := strings.TrimSpace(c.Req.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return remoteIP
+}
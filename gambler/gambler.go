@@ -1,9 +1,13 @@
 package gambler
 
 import (
+	"context"
+	"fmt"
 	"html/template"
-	"log"
+	"io/fs"
+	"net"
 	"net/http"
+	"os"
 	"path"
 	"strings"
 )
@@ -14,10 +18,12 @@ import (
 type HandlerFunc func(c *Context)
 
 type RouterGroup struct {
-	prefix      string        // 例如 / 或者 /api
-	middlewares []HandlerFunc // 支持中间件
-	parent      *RouterGroup  // 为了支持嵌套分组，需要知道父分组
-	engine      *Engine       // 需要有访问 router 的能力，所以保存一个指向 engine 的指针，方便通过 engine 访问各种接口，也意味着框架的资源由 engine 协调
+	prefix       string        // 例如 / 或者 /api
+	middlewares  []HandlerFunc // 支持中间件
+	parent       *RouterGroup  // 为了支持嵌套分组，需要知道父分组
+	engine       *Engine       // 需要有访问 router 的能力，所以保存一个指向 engine 的指针，方便通过 engine 访问各种接口，也意味着框架的资源由 engine 协调
+	maxBodySize  int64         // 请求 body 的大小限制，0 表示使用上层分组的限制，小于 0 表示不限制
+	htmlRenderer HTMLRenderer  // HTML 渲染引擎，为空时使用上层分组的设置
 }
 
 // Engine 定义实例引擎,集中保存管理路由
@@ -26,23 +32,42 @@ type RouterGroup struct {
 // 内部类型的属性、方法，可以为外部类型所有，就好像是外部类型自己的一样。
 // 外部类型还可以定义自己的属性和方法，甚至可以定义与内部相同的方法，这样内部类型的方法就会被“屏蔽”
 type Engine struct {
-	router        *router            // 定义路由：key 是理由，value 是处理函数
-	*RouterGroup                     // engine 是最顶层的分组，拥有 RouterGroup 的所有能力
-	groups        []*RouterGroup     // 保存所有的 group
-	htmlTemplates *template.Template // 使用 html/template 的渲染能力，把模板加载到内存中(还有一个text/template)
-	funcMap       template.FuncMap   // 保存所有的自定义模板渲染函数, 是一个map
+	router         *router                 // 定义路由：key 是理由，value 是处理函数
+	*RouterGroup                           // engine 是最顶层的分组，拥有 RouterGroup 的所有能力
+	groups         []*RouterGroup          // 保存所有的 group
+	htmlTemplates  *template.Template      // 使用 html/template 的渲染能力，把模板加载到内存中(还有一个text/template)
+	htmlSet        *templateSet            // htmlTemplates 所在的一组模板，包括从未执行过的副本，需要请求级别的模板函数时使用
+	funcMap        template.FuncMap        // 保存所有的自定义模板渲染函数, 是一个map
+	htmlLoader     *htmlLoader             // 模板的来源，debug 模式下用于热加载
+	htmlPages      map[string]*templateSet // 使用布局时每个页面单独的一组模板，不同页面可以定义同名的 block
+	htmlLayout     string                  // 页面默认使用的布局
+	logger         Logger                  // 框架的日志输出，默认级别由运行模式决定
+	trustedProxy   []*net.IPNet            // 可信代理的网段，ClientIP 只信任来自这些地址的 X-Forwarded-For
+	timeouts       ServerTimeouts          // Run 创建的 http.Server 的超时设置
+	state          serverState             // 正在运行的 Server 的状态和生命周期钩子
+	h2c            bool                    // 是否允许不加密的 HTTP/2
+	redirectAddr   string                  // RunTLS 时监听 HTTP 并重定向到 HTTPS 的地址
+	unixSocketMode os.FileMode             // RunUnix 创建的 socket 文件的权限
+	routes         []*Route                // 按注册顺序保存所有的路由，用于 Routes 查看
+	namedRoutes    map[string]*Route       // 命名的路由，用于 URL 反向生成地址
 }
 
 // New 构造函数
 func New() *Engine {
-	log.Printf("Debug msg : gambler.go -> New : create web engine with router, RouterGroup, groups\n")
-	// 实例化 engine 的 路由对象
-	engine := &Engine{router: NewRouter()}
+	// 实例化 engine 的 路由对象，日志默认按照当前运行模式创建
+	engine := &Engine{
+		router:         NewRouter(),
+		logger:         DefaultLogger(),
+		timeouts:       DefaultServerTimeouts(),
+		unixSocketMode: defaultUnixSocketMode,
+		namedRoutes:    make(map[string]*Route),
+	}
+	engine.router.logger = engine.logger
 	// 实例化 engine 的 分组对象，表示分组对象可以通过engine访问一些接口
 	engine.RouterGroup = &RouterGroup{engine: engine}
 	// 实例化 engine 的 groups 对象，存放多个RouterGroup分组
 	engine.groups = []*RouterGroup{engine.RouterGroup}
-	log.Printf("ENGINE CREATE FINISH\n\n")
+	engine.logger.Debug("engine created", F("mode", Mode()))
 	return engine
 }
 
@@ -50,26 +75,43 @@ func New() *Engine {
 func (engine *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// 为适配中间件而增添的部分
 	var middlewares []HandlerFunc
+	// body 大小限制使用前缀最长的分组的设置
+	var maxBodySize int64
+	matched := -1
+	// HTML 渲染引擎同样使用前缀最长的分组的设置
+	var renderer HTMLRenderer
+	rendererMatched := -1
 	// 拿到和请求对应的分组的所有 中间件 并赋值给 上下文的 hanslers 列表
 	for _, group := range engine.groups {
 		if strings.HasPrefix(req.URL.Path, group.prefix) {
 			middlewares = append(middlewares, group.middlewares...)
+			if group.maxBodySize != 0 && len(group.prefix) > matched {
+				maxBodySize = group.maxBodySize
+				matched = len(group.prefix)
+			}
+			if group.htmlRenderer != nil && len(group.prefix) > rendererMatched {
+				renderer = group.htmlRenderer
+				rendererMatched = len(group.prefix)
+			}
 		}
 	}
 	// 实例化一个 Context
 	c := newContext(w, req)
+	if maxBodySize > 0 && c.limitBody(w, maxBodySize) {
+		middlewares = append(middlewares, abortBodyTooLarge)
+	}
 	// 将中间件列表添加到这个上下文的 hanslers 列表中
 	c.handlers = middlewares
 	// 用于 Context 使用 engine 的方法
 	c.engine = engine
-	log.Printf("Debug msg : gambler.go -> ServeHTTP : create context finish\n")
+	c.htmlRenderer = renderer
 	engine.router.handle(c)
 }
 
 // Run 封装监听函数，监听函数不需要分组，因为所有的路径都需要监听
+// 收到 SIGINT/SIGTERM 时优雅关闭，等待正在处理的请求完成后返回 nil
 func (engine *Engine) Run(addr string) (err error) {
-	log.Printf("LISTENING ADDR = %s\n\n", addr)
-	return http.ListenAndServe(addr, engine)
+	return engine.RunWithContext(context.Background(), addr)
 }
 
 // ShowTree 打印某种请求方式的路由前缀树
@@ -79,20 +121,127 @@ func (engine *Engine) ShowTree(method string, path string) {
 	engine.router.showTree(method, path)
 }
 
-// SetFuncMap 用于设置自定义函数渲染模板 funcMap
+// SetFuncMap 用于设置自定义函数渲染模板 funcMap，会替换之前设置的所有函数，需要合并多组函数时使用 AddFuncMap
+// 需要在 LoadHTMLGlob 之前调用
 func (engine *Engine) SetFuncMap(funcMap template.FuncMap) {
 	engine.funcMap = funcMap
-	log.Printf("Debug msg : gambler.go -> SetFuncMap : SET funcMap FINISH\n")
+	engine.logger.Debug("template funcMap set", F("funcs", len(funcMap)))
+}
+
+// AddFuncMap 把 funcMap 合并到已经设置的模板函数中，同名的函数后设置的生效
+// eg: r.AddFuncMap(gambler.FuncMap()); r.AddFuncMap(r.URLFuncMap())，需要在 LoadHTMLGlob 之前调用
+func (engine *Engine) AddFuncMap(funcMap template.FuncMap) {
+	merged := make(template.FuncMap, len(engine.funcMap)+len(funcMap))
+	for name, fn := range engine.funcMap {
+		merged[name] = fn
+	}
+	for name, fn := range funcMap {
+		merged[name] = fn
+	}
+	engine.funcMap = merged
+	engine.logger.Debug("template funcMap added", F("funcs", len(funcMap)))
 }
 
-// LoadHTMLGlob 用于加载模板
+// SetLogger 替换框架使用的 Logger，传入 nil 时关闭所有日志
+func (engine *Engine) SetLogger(logger Logger) {
+	if logger == nil {
+		logger = nopLogger{}
+	}
+	engine.logger = logger
+	engine.router.logger = logger
+}
+
+// Logger 返回框架使用的 Logger
+func (engine *Engine) Logger() Logger {
+	return engine.logger
+}
+
+// LoadHTMLGlob 用于加载模板，debug 模式下模板文件有变化时自动重新加载
 func (engine *Engine) LoadHTMLGlob(pattern string) {
-	engine.htmlTemplates = template.Must(template.New("").Funcs(engine.funcMap).ParseGlob(pattern))
+	engine.loadHTML(&htmlLoader{
+		parse: func(root *template.Template) (*parsedTemplates, error) {
+			root, err := root.ParseGlob(pattern)
+			return &parsedTemplates{root: root}, err
+		},
+		signature: globSignature(pattern),
+	})
+}
+
+// LoadHTMLFiles 加载指定的模板文件，debug 模式下模板文件有变化时自动重新加载
+func (engine *Engine) LoadHTMLFiles(files ...string) {
+	engine.loadHTML(&htmlLoader{
+		parse: func(root *template.Template) (*parsedTemplates, error) {
+			root, err := root.ParseFiles(files...)
+			return &parsedTemplates{root: root}, err
+		},
+		signature: func() (string, error) {
+			return filesSignature(append([]string(nil), files...))
+		},
+	})
+}
+
+// LoadHTMLFS 从 fs.FS 中加载模板，eg: 使用 go:embed 把模板打包进二进制文件
+// eg: LoadHTMLFS(templatesFS, "templates/*.tmpl")
+// fsys 是 os.DirFS 等能拿到修改时间的文件系统时，debug 模式下同样支持热加载
+func (engine *Engine) LoadHTMLFS(fsys fs.FS, patterns ...string) {
+	engine.loadHTML(&htmlLoader{
+		parse: func(root *template.Template) (*parsedTemplates, error) {
+			root, err := root.ParseFS(fsys, patterns...)
+			return &parsedTemplates{root: root}, err
+		},
+		signature: fsSignature(fsys, patterns),
+	})
+}
+
+// SetHTMLTemplate 直接使用调用方解析好的模板，模板中用到的函数需要在解析前通过 Funcs 设置
+// 模板不能已经执行过，否则无法 Clone，不支持热加载
+func (engine *Engine) SetHTMLTemplate(tmpl *template.Template) {
+	engine.htmlLoader = nil
+	engine.setHTMLTemplates(&parsedTemplates{root: tmpl})
+}
+
+// SetTrustedProxies 设置可信代理，支持 IP 和 CIDR，eg: "127.0.0.1", "10.0.0.0/8"
+// 默认不信任任何代理，ClientIP 直接返回连接的对端地址
+func (engine *Engine) SetTrustedProxies(proxies ...string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("gambler: invalid trusted proxy %q", proxy)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			proxy = fmt.Sprintf("%s/%d", proxy, bits)
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("gambler: invalid trusted proxy %q: %w", proxy, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	engine.trustedProxy = nets
+	return nil
+}
+
+// isTrustedProxy 判断 ip 是否属于可信代理
+func (engine *Engine) isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range engine.trustedProxy {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
 }
 
 // NewGroup 创建 RouterGroup, 所有的 groups 都共享一个相同的 engine 接口
 func (group *RouterGroup) NewGroup(prefix string) *RouterGroup {
-	log.Printf("Debug msg : gambler.go -> NewGroup : create NewGroup with prefix = %v, newGroup prefix = %v\n", prefix, group.prefix+prefix)
 	engine := group.engine
 	// 新的分组
 	newGroup := &RouterGroup{
@@ -102,50 +251,47 @@ func (group *RouterGroup) NewGroup(prefix string) *RouterGroup {
 	}
 	// 保存新创建的分组
 	engine.groups = append(engine.groups, newGroup)
-	log.Printf("GROUP REGISTER FINISH: group = %s\n\n", newGroup.prefix)
+	engine.logger.Debug("group registered", F("prefix", newGroup.prefix))
 	return newGroup
 }
 
 // addRoute 实现添加路由功能：method是请求方式，pattern是路径，handlerFunc是处理函数
-func (group *RouterGroup) addRoute(method string, comp string, handler HandlerFunc) {
-	log.Printf("Debug msg : gambler.go -> addRoute : method = %s, pattern = %s + %s\n", method, group.prefix, comp)
+// 返回的 Route 可以通过 Name 命名
+func (group *RouterGroup) addRoute(method string, comp string, handler HandlerFunc) *Route {
 	// comp 是不包含前缀的路径，在真正添加路由的时候需要拼接起来。
 	// 如果没有调用新建分组那么这个前缀会设置为空
 	pattern := group.prefix + comp
 	//log.Printf("***** comp = %s *****", comp)
 	// router.addRouter 需要通过 engine 来调用
 	group.engine.router.addRouter(method, pattern, handler)
-	log.Printf("ROUTE REGISTER FINISH : method = %s, path = %s \n\n", method, pattern)
+	group.engine.logger.Debug("route registered", F("method", method), F("path", pattern))
+	route := &Route{Method: method, Path: pattern, engine: group.engine, handler: handler}
+	group.engine.routes = append(group.engine.routes, route)
+	return route
 }
 
 // GET 实现 GET 路由：pattern是路径，handlerFunc是处理函数
-func (group *RouterGroup) GET(pattern string, handler HandlerFunc) {
-	log.Printf("Debug msg : gambler.go -> GET : pattern = %s\n", pattern)
+func (group *RouterGroup) GET(pattern string, handler HandlerFunc) *Route {
 	// addRoute 不需要通过 engine 来调用
-	group.addRoute("GET", pattern, handler)
-	//log.Printf("ROUTE REGISTER FINISH : method = GET, path = %s \n\n", pattern)
+	return group.addRoute("GET", pattern, handler)
 }
 
 // POST 实现 POST 路由：pattern是路径，handlerFunc是处理函数
-func (group *RouterGroup) POST(pattern string, handler HandlerFunc) {
-	log.Printf("Debug msg : gambler.go -> POST : pattern = %s\n", pattern)
+func (group *RouterGroup) POST(pattern string, handler HandlerFunc) *Route {
 	// addRoute 不需要通过 engine 来调用
-	group.addRoute("POST", pattern, handler)
-	//log.Printf("ROUTE REGISTER FINISH : method = POST, path = %s \n\n", pattern)
+	return group.addRoute("POST", pattern, handler)
 }
 
 // PUT 实现 PUT 路由：pattern是路径，handlerFunc是处理函数
-func (group *RouterGroup) PUT(pattern string, handler HandlerFunc) {
-	log.Printf("Debug msg : gambler.go -> PUT : pattern = %s\n", pattern)
+func (group *RouterGroup) PUT(pattern string, handler HandlerFunc) *Route {
 	// addRoute 不需要通过 engine 来调用
-	group.addRoute("PUT", pattern, handler)
-	//log.Printf("ROUTE REGISTER FINISH : method = PUT, path = %s \n\n", pattern)
+	return group.addRoute("PUT", pattern, handler)
 }
 
 // UseMiddlewares 将中间件应用到某一个 group 中
 func (group *RouterGroup) UseMiddlewares(middlewares ...HandlerFunc) {
 	group.middlewares = append(group.middlewares, middlewares...)
-	log.Printf("Debug msg : gambler.go -> UseMiddleWare : use middlewares:%v for group : %v\n", group.middlewares, group.prefix)
+	group.engine.logger.Debug("middlewares added", F("group", group.prefix), F("count", len(group.middlewares)))
 }
 
 // createStaticHandler 创建静态文件的 handler，浏览器收到html文件，会自动执行加载css，发起http请求
@@ -155,7 +301,7 @@ func (group *RouterGroup) createStaticHandler(relativePath string, fs http.FileS
 	// StripPrefix将URL中的前缀中的prefix字符串删除，然后再交给后面的Handler处理，返回值是一个 handler
 	// http.FileServer 返回一个 handler，
 	fileServer := http.StripPrefix(absolutePath, http.FileServer(fs))
-	log.Printf("Debug msg : gambler.go -> createStaticHandler : absolutePath = %v + %v, FINISH STATIC FILE HANDLER\n", group.prefix, relativePath)
+	group.engine.logger.Debug("static handler created", F("path", absolutePath))
 	return func(c *Context) {
 		// 获取文件名
 		file := c.GetParam("filepath")
@@ -170,9 +316,16 @@ func (group *RouterGroup) createStaticHandler(relativePath string, fs http.FileS
 }
 
 // Static 用于映射路径，可以将磁盘上某个文件夹的 root 映射到 relativePath
-func (group *RouterGroup) Static(relativePath string, root string) {
-	log.Printf("Debug msg : gambler.go -> Static : register static file\n")
+func (group *RouterGroup) Static(relativePath string, root string) *Route {
 	handler := group.createStaticHandler(relativePath, http.Dir(root))
 	urlPattern := path.Join(relativePath, "/*filepath")
-	group.GET(urlPattern, handler)
+	return group.GET(urlPattern, handler)
+}
+
+// StaticFS 和 Static 一样，文件来自 fs.FS，eg: 使用 go:embed 打包进二进制文件的静态文件
+// embed.FS 中的文件带有目录前缀，可以通过 fs.Sub 去掉，eg: StaticFS("/assets", sub)，sub, _ := fs.Sub(staticFS, "static")
+func (group *RouterGroup) StaticFS(relativePath string, fsys fs.FS) *Route {
+	handler := group.createStaticHandler(relativePath, http.FS(fsys))
+	urlPattern := path.Join(relativePath, "/*filepath")
+	return group.GET(urlPattern, handler)
 }
@@ -1,6 +1,11 @@
 package gambler
 
-import "testing"
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
 
 func TestNestedGroup(t *testing.T) {
 	r := New()
@@ -14,3 +19,45 @@ func TestNestedGroup(t *testing.T) {
 		t.Fatal("v2 prefix should be /v1/v2")
 	}
 }
+
+func TestStaticFS(t *testing.T) {
+	r := New()
+	r.StaticFS("/assets", fstest.MapFS{
+		"css/site.css": {Data: []byte("body{}")},
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/assets/css/site.css", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "body{}" {
+		t.Fatalf("static file should be served from fs.FS, got %d %q", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/assets/missing.css", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("missing file should be 404, got %d", w.Code)
+	}
+}
+
+func TestIsAborted(t *testing.T) {
+	var normal, aborted bool
+	r := New()
+	r.SetLogger(nil)
+	r.UseMiddlewares(func(c *Context) {
+		c.Next()
+		if c.Path == "/ok" {
+			normal = c.IsAborted()
+		} else {
+			aborted = c.IsAborted()
+		}
+	})
+	r.GET("/ok", func(c *Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/fail", func(c *Context) {
+		c.Fail(http.StatusForbidden, "Forbidden")
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ok", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fail", nil))
+	if normal || !aborted {
+		t.Fatalf("IsAborted should only be true after Abort, got normal=%v aborted=%v", normal, aborted)
+	}
+}
@@ -1,4 +1,4 @@
 module gambler
 
-go 1.18
+go 1.24
 
@@ -0,0 +1,133 @@
+package gambler
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+)
+
+// htmlRenderer.go: 可替换的 HTML 渲染引擎
+// Context.HTML 通过 HTMLRenderer 渲染，默认使用 LoadHTMLGlob 等方法加载的 html/template 模板
+// 可以在 Engine 或者分组上通过 SetHTMLRenderer 替换，eg: 使用 text/template、预编译好的模板或者其他模板引擎
+// 分组的设置优先，匹配到的前缀最长的分组的渲染引擎生效
+
+// HTMLRenderOptions 一次渲染的参数
+type HTMLRenderOptions struct {
+	Layout         string           // HTMLWithLayout 指定的布局
+	OverrideLayout bool             // 是否使用 Layout 代替默认的布局，Layout 为空时不使用布局
+	Funcs          template.FuncMap // 请求级别的模板函数，eg: csrfToken，没有时为 nil
+}
+
+// HTMLRenderer HTML 渲染引擎，Render 返回错误时 Context 会返回 500，已经写入 w 的内容会被丢弃
+type HTMLRenderer interface {
+	Render(w io.Writer, name string, data interface{}, opts HTMLRenderOptions) error
+}
+
+// SetHTMLRenderer 设置分组(包括 Engine)的 HTML 渲染引擎，为 nil 时使用上层分组的设置
+func (group *RouterGroup) SetHTMLRenderer(renderer HTMLRenderer) {
+	group.htmlRenderer = renderer
+	group.engine.logger.Debug("html renderer set", F("group", group.prefix), F("renderer", fmt.Sprintf("%T", renderer)))
+}
+
+// engineRenderer 默认的渲染引擎，使用 Engine 上通过 LoadHTMLGlob、LoadHTMLLayouts 等方法加载的模板
+type engineRenderer struct {
+	engine *Engine
+}
+
+func (r engineRenderer) Render(w io.Writer, name string, data interface{}, opts HTMLRenderOptions) error {
+	set, layout, err := r.engine.templates(name)
+	if err != nil {
+		return err
+	}
+	if opts.OverrideLayout {
+		layout = opts.Layout
+	}
+	return set.execute(w, name, layout, data, opts.Funcs)
+}
+
+// execute 渲染页面，layout 不为空时执行布局，布局中的 block 由页面中的 define 覆盖
+func (set templateSet) execute(w io.Writer, page string, layout string, data interface{}, funcs template.FuncMap) error {
+	if set.tmpl.Lookup(page) == nil {
+		return fmt.Errorf("gambler: template %q not found", page)
+	}
+	name := page
+	if layout != "" {
+		name = layout
+	}
+	if len(funcs) == 0 {
+		return set.tmpl.ExecuteTemplate(w, name, data)
+	}
+	// 有请求级别的模板函数时使用副本，同一组名字的函数每次都会被全部替换，所以副本可以复用，不会用到上一个请求的函数
+	pool := set.clonePool(funcs)
+	tmpl, _ := pool.Get().(*template.Template)
+	if tmpl == nil {
+		clone, err := set.base.Clone()
+		if err != nil {
+			return err
+		}
+		tmpl = clone
+	}
+	err := tmpl.Funcs(funcs).ExecuteTemplate(w, name, data)
+	pool.Put(tmpl)
+	return err
+}
+
+// clonePool 返回请求级别函数的名字对应的副本池
+func (set templateSet) clonePool(funcs template.FuncMap) *sync.Pool {
+	names := make([]string, 0, len(funcs))
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	key := strings.Join(names, ",")
+	if pool, ok := set.clones.Load(key); ok {
+		return pool.(*sync.Pool)
+	}
+	pool, _ := set.clones.LoadOrStore(key, &sync.Pool{})
+	return pool.(*sync.Pool)
+}
+
+// NewHTMLTemplateRenderer 使用预编译好的 html/template 模板，模板不能已经执行过
+func NewHTMLTemplateRenderer(tmpl *template.Template) HTMLRenderer {
+	return htmlTemplateRenderer{set: *newTemplateSet(tmpl)}
+}
+
+type htmlTemplateRenderer struct {
+	set templateSet
+}
+
+func (r htmlTemplateRenderer) Render(w io.Writer, name string, data interface{}, opts HTMLRenderOptions) error {
+	return r.set.execute(w, name, opts.Layout, data, opts.Funcs)
+}
+
+// NewTextTemplateRenderer 使用 text/template 模板，不会对输出做 HTML 转义，只用于可信的数据
+func NewTextTemplateRenderer(tmpl *texttemplate.Template) HTMLRenderer {
+	return textTemplateRenderer{tmpl: tmpl}
+}
+
+type textTemplateRenderer struct {
+	tmpl *texttemplate.Template
+}
+
+func (r textTemplateRenderer) Render(w io.Writer, name string, data interface{}, opts HTMLRenderOptions) error {
+	if r.tmpl.Lookup(name) == nil {
+		return fmt.Errorf("gambler: template %q not found", name)
+	}
+	tmpl := r.tmpl
+	if len(opts.Funcs) > 0 {
+		// text/template 执行过之后仍然可以 Clone
+		clone, err := tmpl.Clone()
+		if err != nil {
+			return err
+		}
+		tmpl = clone.Funcs(texttemplate.FuncMap(opts.Funcs))
+	}
+	if opts.Layout != "" {
+		name = opts.Layout
+	}
+	return tmpl.ExecuteTemplate(w, name, data)
+}
@@ -0,0 +1,113 @@
+package gambler
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	texttemplate "text/template"
+)
+
+func TestHTMLRenderer(t *testing.T) {
+	r := New()
+	r.SetLogger(nil)
+	r.SetHTMLTemplate(template.Must(template.New("page").Parse(`html {{ . }}`)))
+	r.GET("/page", func(c *Context) {
+		c.HTML(http.StatusOK, "page", "<b>")
+	})
+
+	text := r.NewGroup("/text")
+	text.SetHTMLRenderer(NewTextTemplateRenderer(texttemplate.Must(texttemplate.New("page").Parse(`text {{ . }}`))))
+	text.GET("/page", func(c *Context) {
+		c.HTML(http.StatusCreated, "page", "<b>")
+	})
+
+	// 前缀更长的分组覆盖上层分组的渲染引擎，模板中的请求级别函数同样生效
+	tmpl := template.Must(template.New("page").Funcs(template.FuncMap{"user": func() string { return "" }}).
+		Parse(`precompiled {{ user }}`))
+	precompiled := text.NewGroup("/precompiled")
+	precompiled.SetHTMLRenderer(NewHTMLTemplateRenderer(tmpl))
+	precompiled.GET("/page", func(c *Context) {
+		c.SetTemplateFunc("user", func() string { return "liup2" })
+		c.HTML(http.StatusOK, "page", nil)
+	})
+
+	cases := []struct {
+		url  string
+		code int
+		want string
+	}{
+		{"/page", http.StatusOK, "html &lt;b&gt;"},
+		{"/text/page", http.StatusCreated, "text <b>"},
+		{"/text/precompiled/page", http.StatusOK, "precompiled liup2"},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", tc.url, nil))
+		if w.Code != tc.code || w.Body.String() != tc.want {
+			t.Fatalf("%s: want %d %q, got %d %q", tc.url, tc.code, tc.want, w.Code, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/html" {
+			t.Fatalf("%s: unexpected Content-Type %q", tc.url, ct)
+		}
+	}
+}
+
+func TestHTMLRendererError(t *testing.T) {
+	defer SetMode(Mode())
+	SetMode(ReleaseMode)
+	r := New()
+	r.SetLogger(nil)
+	// 执行到一半出错，已经渲染的内容不能写到响应中
+	r.SetHTMLRenderer(NewTextTemplateRenderer(texttemplate.Must(texttemplate.New("page").Parse(`partial {{ .Missing }}`))))
+	r.GET("/page", func(c *Context) {
+		c.HTML(http.StatusOK, "page", 1)
+	})
+	r.GET("/missing", func(c *Context) {
+		c.HTML(http.StatusOK, "missing", nil)
+	})
+	for _, url := range []string{"/page", "/missing"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "partial") {
+			t.Fatalf("%s: want 500 without partial output, got %d %q", url, w.Code, w.Body.String())
+		}
+	}
+}
+
+func newRequestFuncsTestEngine() *Engine {
+	r := New()
+	r.SetLogger(nil)
+	r.SetFuncMap(template.FuncMap{"user": func() string { return "" }})
+	r.SetHTMLTemplate(template.Must(template.New("page").Funcs(r.funcMap).
+		Parse(`<p title="{{ user }}">{{ user }} {{ . }}</p>{{ range $i, $v := . }}<a href="/{{ $v }}">{{ $i }}</a>{{ end }}`)))
+	r.GET("/page/:user", func(c *Context) {
+		user := c.GetParam("user")
+		c.SetTemplateFunc("user", func() string { return user })
+		c.HTML(http.StatusOK, "page", []string{"a", "b"})
+	})
+	return r
+}
+
+func TestHTMLRequestFuncsReuse(t *testing.T) {
+	r := newRequestFuncsTestEngine()
+	for _, user := range []string{"alice", "bob", "alice"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/page/"+user, nil))
+		if !strings.HasPrefix(w.Body.String(), `<p title="`+user+`">`+user+" ") {
+			t.Fatalf("request funcs of %s should be used, got %q", user, w.Body.String())
+		}
+	}
+}
+
+// BenchmarkHTMLRequestFuncs 有请求级别模板函数(eg: CSRF、CSP nonce)时的渲染，模板的副本会被复用，不会每次都重新转义
+func BenchmarkHTMLRequestFuncs(b *testing.B) {
+	r := newRequestFuncsTestEngine()
+	req := httptest.NewRequest("GET", "/page/alice", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
@@ -0,0 +1,216 @@
+package gambler
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logger.go: 框架内部日志，所有的诊断信息都通过 Engine 上的 Logger 输出
+// 日志分为 Debug、Info、Warn、Error 四个级别，并支持结构化字段 key=value
+// 运行模式分为 debug、release、test 三种，不同模式对应不同的默认日志级别，生产环境默认是 release 模式，只输出警告和错误
+
+// LogLevel 日志级别
+type LogLevel int8
+
+const (
+	LevelDebug  LogLevel = iota // 调试信息，每个请求都可能输出，只在 debug 模式下打开
+	LevelInfo                   // 一般信息，例如服务启动、路由注册完成
+	LevelWarn                   // 警告信息
+	LevelError                  // 错误信息，例如 panic 恢复
+	LevelSilent                 // 关闭所有日志
+)
+
+// String 返回日志级别的名称
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	case LevelSilent:
+		return "SILENT"
+	}
+	return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+}
+
+// Field 结构化日志字段
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F 构造一个结构化日志字段，eg: logger.Info("route registered", F("method", "GET"), F("path", "/hello"))
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger 框架使用的日志接口，可以通过 Engine.SetLogger 替换成自己的实现
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+	// Enabled 判断某个级别是否会输出，热路径上先判断再构造字段，避免无用的开销
+	Enabled(level LogLevel) bool
+	// With 返回一个携带固定字段的子 Logger
+	With(fields ...Field) Logger
+}
+
+// 运行模式
+const (
+	DebugMode   = "debug"
+	ReleaseMode = "release"
+	TestMode    = "test"
+)
+
+// EnvGamblerMode 用于通过环境变量设置运行模式
+const EnvGamblerMode = "GAMBLER_MODE"
+
+var (
+	modeMu      sync.RWMutex
+	gamblerMode = ReleaseMode
+)
+
+func init() {
+	if mode := os.Getenv(EnvGamblerMode); mode != "" {
+		SetMode(mode)
+	}
+}
+
+// SetMode 设置运行模式，只影响之后创建的 Engine 的默认日志级别
+func SetMode(mode string) {
+	switch mode {
+	case DebugMode, ReleaseMode, TestMode:
+	case "":
+		mode = ReleaseMode
+	default:
+		panic("gambler: unknown mode " + mode + ", available: debug release test")
+	}
+	modeMu.Lock()
+	gamblerMode = mode
+	modeMu.Unlock()
+}
+
+// Mode 返回当前的运行模式
+func Mode() string {
+	modeMu.RLock()
+	defer modeMu.RUnlock()
+	return gamblerMode
+}
+
+// IsDebugging 当前是否为 debug 模式
+func IsDebugging() bool {
+	return Mode() == DebugMode
+}
+
+// modeLevel 返回运行模式对应的默认日志级别
+func modeLevel(mode string) LogLevel {
+	switch mode {
+	case DebugMode:
+		return LevelDebug
+	case TestMode:
+		return LevelError
+	}
+	return LevelWarn
+}
+
+// DefaultLogger 按照当前运行模式创建一个输出到 os.Stderr 的 Logger
+func DefaultLogger() Logger {
+	return NewLogger(os.Stderr, modeLevel(Mode()))
+}
+
+// NewLogger 创建一个文本格式的 Logger，输出形如：
+// [GAMBLER] 2006/01/02 15:04:05 INFO route registered method=GET path=/hello
+func NewLogger(out io.Writer, level LogLevel) Logger {
+	return &textLogger{out: out, level: level, mu: &sync.Mutex{}}
+}
+
+// textLogger Logger 的默认实现
+type textLogger struct {
+	out    io.Writer
+	level  LogLevel
+	fields []Field     // With 添加的固定字段
+	mu     *sync.Mutex // 子 Logger 和父 Logger 共享同一把锁，保证同一个 out 上的输出不会交错
+}
+
+func (l *textLogger) Enabled(level LogLevel) bool {
+	return level >= l.level && level < LevelSilent
+}
+
+func (l *textLogger) Debug(msg string, fields ...Field) { l.output(LevelDebug, msg, fields) }
+func (l *textLogger) Info(msg string, fields ...Field)  { l.output(LevelInfo, msg, fields) }
+func (l *textLogger) Warn(msg string, fields ...Field)  { l.output(LevelWarn, msg, fields) }
+func (l *textLogger) Error(msg string, fields ...Field) { l.output(LevelError, msg, fields) }
+
+func (l *textLogger) With(fields ...Field) Logger {
+	child := *l
+	child.fields = make([]Field, 0, len(l.fields)+len(fields))
+	child.fields = append(child.fields, l.fields...)
+	child.fields = append(child.fields, fields...)
+	return &child
+}
+
+// output 拼接一行日志并写入 out
+func (l *textLogger) output(level LogLevel, msg string, fields []Field) {
+	if !l.Enabled(level) {
+		return
+	}
+	var b strings.Builder
+	b.WriteString("[GAMBLER] ")
+	b.WriteString(time.Now().Format("2006/01/02 15:04:05"))
+	b.WriteByte(' ')
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for _, f := range l.fields {
+		writeField(&b, f)
+	}
+	for _, f := range fields {
+		writeField(&b, f)
+	}
+	b.WriteByte('\n')
+	l.mu.Lock()
+	io.WriteString(l.out, b.String())
+	l.mu.Unlock()
+}
+
+// writeField 以 key=value 的形式写入一个字段，value 中含有空格等字符时加上引号
+func writeField(b *strings.Builder, f Field) {
+	b.WriteByte(' ')
+	b.WriteString(f.Key)
+	b.WriteByte('=')
+	var s string
+	switch v := f.Value.(type) {
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		s = strconv.Quote(s)
+	}
+	b.WriteString(s)
+}
+
+// nopLogger 不输出任何内容的 Logger，用于没有 engine 的场景
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...Field) {}
+func (nopLogger) Info(string, ...Field)  {}
+func (nopLogger) Warn(string, ...Field)  {}
+func (nopLogger) Error(string, ...Field) {}
+func (nopLogger) Enabled(LogLevel) bool  { return false }
+func (n nopLogger) With(...Field) Logger { return n }
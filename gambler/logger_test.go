@@ -0,0 +1,44 @@
+package gambler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLoggerLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, LevelInfo)
+	logger.Debug("debug msg")
+	logger.Info("route registered", F("method", "GET"), F("path", "/hello world"))
+	out := buf.String()
+	if strings.Contains(out, "debug msg") {
+		t.Fatal("debug msg should be filtered by LevelInfo")
+	}
+	if !strings.Contains(out, `INFO route registered method=GET path="/hello world"`) {
+		t.Fatalf("unexpected log output: %s", out)
+	}
+}
+
+func TestLoggerWith(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, LevelDebug).With(F("request_id", "abc"))
+	logger.Error("panic recovered")
+	if !strings.HasSuffix(buf.String(), "ERROR panic recovered request_id=abc\n") {
+		t.Fatalf("unexpected log output: %s", buf.String())
+	}
+}
+
+func TestModeLevel(t *testing.T) {
+	defer SetMode(Mode())
+	SetMode(DebugMode)
+	r := New()
+	if !r.Logger().Enabled(LevelDebug) {
+		t.Fatal("debug mode should enable debug logs")
+	}
+	SetMode(ReleaseMode)
+	r = New()
+	if r.Logger().Enabled(LevelInfo) {
+		t.Fatal("release mode should be quiet")
+	}
+}
@@ -0,0 +1,608 @@
+package gambler
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openapi.go: 根据注册的路由生成 OpenAPI 3.1 文档
+// 路径参数(:name、*filepath)自动生成，其他信息在注册路由时描述，请求和响应的类型通过反射结构体生成 schema
+// eg: r.POST("/users/:id", handler).Summary("修改用户").Tags("user").
+//   QueryParams(UserQuery{}).Body(UpdateUser{}).Response(200, User{}).Response(404, nil)
+// 结构体字段使用 json tag 命名(查询参数使用 query tag，表单请求体使用 form tag)，omitempty 和指针类型的字段是可选的，description tag 作为字段的说明
+// ServeOpenAPI 提供文档的 JSON 和一个离线的文档查看页面，页面的资源打包在二进制文件中
+
+//go:embed openapiui
+var openAPIUI embed.FS
+
+// openAPIUITemplate 文档查看页面
+var openAPIUITemplate = template.Must(template.ParseFS(openAPIUI, "openapiui/index.html"))
+
+// openAPIVersion 生成的文档使用的 OpenAPI 版本
+const openAPIVersion = "3.1.0"
+
+// OpenAPIConfig 生成和提供 OpenAPI 文档的配置
+type OpenAPIConfig struct {
+	Title       string   // 文档标题，默认 API
+	Version     string   // API 的版本，默认 1.0.0
+	Description string   // API 的说明
+	Servers     []string // API 的地址，eg: https://api.example.com，为空时使用文档所在的地址
+	SpecPath    string   // 文档 JSON 的路径，默认 /openapi.json
+	UIPath      string   // 文档查看页面的路径，eg: /docs，为空时不提供，不能是 /
+}
+
+// DefaultOpenAPIConfig 返回默认的 OpenAPI 配置，不提供文档查看页面
+func DefaultOpenAPIConfig() OpenAPIConfig {
+	return OpenAPIConfig{
+		Title:    "API",
+		Version:  "1.0.0",
+		SpecPath: "/openapi.json",
+	}
+}
+
+// routeDoc 路由在文档中的描述
+type routeDoc struct {
+	summary     string
+	description string
+	tags        []string
+	body        reflect.Type
+	bodyType    string // 请求体的 Content-Type
+	query       reflect.Type
+	params      []openAPIParameter
+	responses   []routeResponse
+	hidden      bool
+}
+
+// routeResponse 一种响应，typ 为空时响应没有内容
+type routeResponse struct {
+	code int
+	typ  reflect.Type
+}
+
+// Summary 设置路由在文档中的摘要
+func (route *Route) Summary(summary string) *Route {
+	route.doc.summary = summary
+	return route
+}
+
+// Description 设置路由在文档中的详细说明
+func (route *Route) Description(description string) *Route {
+	route.doc.description = description
+	return route
+}
+
+// Tags 设置路由在文档中的分类
+func (route *Route) Tags(tags ...string) *Route {
+	route.doc.tags = append(route.doc.tags, tags...)
+	return route
+}
+
+// Body 设置 JSON 请求体的类型，v 是这个类型的值，eg: Body(LoginRequest{})
+func (route *Route) Body(v interface{}) *Route {
+	route.doc.body = reflect.TypeOf(v)
+	route.doc.bodyType = "application/json"
+	return route
+}
+
+// FormBody 设置表单请求体(application/x-www-form-urlencoded)，v 是结构体，每个字段是一个表单字段，字段名使用 form tag
+// eg: 通过 c.PostForm 读取的表单 FormBody(LoginForm{})
+func (route *Route) FormBody(v interface{}) *Route {
+	route.doc.body = reflect.TypeOf(v)
+	route.doc.bodyType = "application/x-www-form-urlencoded"
+	return route
+}
+
+// QueryParams 设置查询参数，v 是结构体，每个字段是一个参数，参数名使用 query tag
+func (route *Route) QueryParams(v interface{}) *Route {
+	route.doc.query = reflect.TypeOf(v)
+	return route
+}
+
+// Param 添加一个字符串类型的参数，in 是参数的位置：path、query、header、cookie，路径参数是必填的
+// 路径参数会根据路由自动生成，同名时使用这里的描述
+func (route *Route) Param(in string, name string, description string) *Route {
+	route.doc.params = append(route.doc.params, openAPIParameter{
+		Name:        name,
+		In:          in,
+		Description: description,
+		Required:    in == "path",
+		Schema:      &openAPISchema{Type: "string"},
+	})
+	return route
+}
+
+// Response 添加一种 JSON 响应，v 为 nil 时响应没有内容，eg: Response(200, User{})、Response(404, nil)
+func (route *Route) Response(code int, v interface{}) *Route {
+	route.doc.responses = append(route.doc.responses, routeResponse{code: code, typ: reflect.TypeOf(v)})
+	return route
+}
+
+// Hide 不在文档中显示这个路由
+func (route *Route) Hide() *Route {
+	route.doc.hidden = true
+	return route
+}
+
+// OpenAPI 文档的结构，只包含生成时用到的字段
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Servers    []openAPIServer                         `json:"servers,omitempty"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components *openAPIComponents                      `json:"components,omitempty"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type openAPIServer struct {
+	URL string `json:"url"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]*openAPISchema `json:"schemas,omitempty"`
+}
+
+type openAPIOperation struct {
+	OperationID string                      `json:"operationId,omitempty"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []openAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                         `json:"required"`
+	Content  map[string]*openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	ContentEncoding      string                    `json:"contentEncoding,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Minimum              *int                      `json:"minimum,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+}
+
+// OpenAPI 根据注册的路由生成 OpenAPI 3.1 文档的 JSON
+func (engine *Engine) OpenAPI(conf OpenAPIConfig) ([]byte, error) {
+	doc := openAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info:    openAPIInfo{Title: conf.Title, Version: conf.Version, Description: conf.Description},
+		Paths:   make(map[string]map[string]*openAPIOperation),
+	}
+	if doc.Info.Title == "" {
+		doc.Info.Title = "API"
+	}
+	if doc.Info.Version == "" {
+		doc.Info.Version = "1.0.0"
+	}
+	for _, server := range conf.Servers {
+		doc.Servers = append(doc.Servers, openAPIServer{URL: server})
+	}
+
+	g := &schemaGenerator{schemas: make(map[string]*openAPISchema), names: make(map[reflect.Type]string)}
+	for _, route := range engine.registeredRoutes() {
+		if route.doc.hidden {
+			continue
+		}
+		p, op, err := route.operation(g)
+		if err != nil {
+			return nil, fmt.Errorf("gambler: openapi %s %s: %w", route.Method, route.Path, err)
+		}
+		if doc.Paths[p] == nil {
+			doc.Paths[p] = make(map[string]*openAPIOperation)
+		}
+		doc.Paths[p][strings.ToLower(route.Method)] = op
+	}
+	if len(g.schemas) > 0 {
+		doc.Components = &openAPIComponents{Schemas: g.schemas}
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// operation 生成路由在文档中的路径和操作，路由中的 :name 和 *name 转换成 {name}
+func (route *Route) operation(g *schemaGenerator) (string, *openAPIOperation, error) {
+	op := &openAPIOperation{
+		OperationID: route.name,
+		Summary:     route.doc.summary,
+		Description: route.doc.description,
+		Tags:        route.doc.tags,
+		Responses:   make(map[string]*openAPIResponse),
+	}
+	described := make(map[string]bool, len(route.doc.params))
+	for _, param := range route.doc.params {
+		described[param.In+"-"+param.Name] = true
+	}
+
+	var b strings.Builder
+	parts := parsePattern(route.Path)
+	for _, part := range parts {
+		b.WriteByte('/')
+		if part[0] != ':' && part[0] != '*' {
+			b.WriteString(part)
+			continue
+		}
+		name := part[1:]
+		if name == "" {
+			// 没有名字的 * 不能作为参数
+			name = "wildcard"
+		}
+		fmt.Fprintf(&b, "{%s}", name)
+		if !described["path-"+name] {
+			op.Parameters = append(op.Parameters, openAPIParameter{
+				Name: name, In: "path", Required: true, Schema: &openAPISchema{Type: "string"},
+			})
+		}
+	}
+	if len(parts) == 0 || (strings.HasSuffix(route.Path, "/") && parts[len(parts)-1][0] != '*') {
+		b.WriteByte('/')
+	}
+	op.Parameters = append(op.Parameters, route.doc.params...)
+
+	if route.doc.query != nil {
+		params, err := g.queryParams(route.doc.query)
+		if err != nil {
+			return "", nil, err
+		}
+		op.Parameters = append(op.Parameters, params...)
+	}
+	if route.doc.body != nil {
+		var schema *openAPISchema
+		var err error
+		if route.doc.bodyType == "application/json" {
+			schema, err = g.schema(route.doc.body)
+		} else {
+			schema, err = g.form(route.doc.body)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		op.RequestBody = &openAPIRequestBody{
+			Required: true,
+			Content:  map[string]*openAPIMediaType{route.doc.bodyType: {Schema: schema}},
+		}
+	}
+	for _, resp := range route.doc.responses {
+		r := &openAPIResponse{Description: http.StatusText(resp.code)}
+		if r.Description == "" {
+			r.Description = strconv.Itoa(resp.code)
+		}
+		if resp.typ != nil {
+			schema, err := g.schema(resp.typ)
+			if err != nil {
+				return "", nil, err
+			}
+			r.Content = map[string]*openAPIMediaType{"application/json": {Schema: schema}}
+		}
+		op.Responses[strconv.Itoa(resp.code)] = r
+	}
+	if len(op.Responses) == 0 {
+		op.Responses["200"] = &openAPIResponse{Description: http.StatusText(http.StatusOK)}
+	}
+	return b.String(), op, nil
+}
+
+// schemaGenerator 通过反射生成 schema，有名字的结构体放到 components 中引用
+type schemaGenerator struct {
+	schemas map[string]*openAPISchema
+	names   map[reflect.Type]string
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema 生成类型的 schema
+func (g *schemaGenerator) schema(t reflect.Type) (*openAPISchema, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &openAPISchema{Type: "string", Format: "date-time"}, nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int64:
+		return &openAPISchema{Type: "integer", Format: "int64"}, nil
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &openAPISchema{Type: "integer", Format: "int32"}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		zero := 0
+		return &openAPISchema{Type: "integer", Minimum: &zero}, nil
+	case reflect.Float32:
+		return &openAPISchema{Type: "number", Format: "float"}, nil
+	case reflect.Float64:
+		return &openAPISchema{Type: "number", Format: "double"}, nil
+	case reflect.String:
+		return &openAPISchema{Type: "string"}, nil
+	case reflect.Interface:
+		// 任意类型
+		return &openAPISchema{}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json 把 []byte 编码成 base64 字符串
+			return &openAPISchema{Type: "string", ContentEncoding: "base64"}, nil
+		}
+		items, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &openAPISchema{Type: "array", Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		values, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &openAPISchema{Type: "object", AdditionalProperties: values}, nil
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		return g.ref(t)
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// ref 有名字的结构体放到 components 中，返回引用，先占位再生成，支持递归的类型
+func (g *schemaGenerator) ref(t reflect.Type) (*openAPISchema, error) {
+	name, ok := g.names[t]
+	if !ok {
+		name = schemaName(t.Name())
+		if _, used := g.schemas[name]; used {
+			// 不同包中的同名类型加上包名区分
+			name = schemaName(strings.ReplaceAll(t.String(), ".", "_"))
+		}
+		g.names[t] = name
+		g.schemas[name] = &openAPISchema{}
+		schema, err := g.object(t)
+		if err != nil {
+			return nil, err
+		}
+		g.schemas[name] = schema
+	}
+	return &openAPISchema{Ref: "#/components/schemas/" + name}, nil
+}
+
+// schemaName 去掉 components 中名字不允许的字符，eg: 泛型类型 Page[main.User]
+func schemaName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// object 生成结构体的 schema，字段和 encoding/json 一样处理，嵌入的结构体字段会展开
+func (g *schemaGenerator) object(t reflect.Type) (*openAPISchema, error) {
+	schema := &openAPISchema{Type: "object", Properties: make(map[string]*openAPISchema)}
+	err := eachField(t, "json", func(field reflect.StructField, name string, required bool) error {
+		prop, err := g.schema(field.Type)
+		if err != nil {
+			return err
+		}
+		if desc := field.Tag.Get("description"); desc != "" {
+			if prop.Ref != "" {
+				// 3.1 中 $ref 可以和其他关键字一起使用
+				prop = &openAPISchema{Ref: prop.Ref}
+			}
+			prop.Description = desc
+		}
+		schema.Properties[name] = prop
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// queryParams 把结构体的每个字段转换成查询参数
+func (g *schemaGenerator) queryParams(t reflect.Type) ([]openAPIParameter, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("query params need a struct, got %s", t)
+	}
+	var params []openAPIParameter
+	err := eachField(t, "query", func(field reflect.StructField, name string, required bool) error {
+		schema, err := g.schema(field.Type)
+		if err != nil {
+			return err
+		}
+		params = append(params, openAPIParameter{
+			Name:        name,
+			In:          "query",
+			Description: field.Tag.Get("description"),
+			Required:    required,
+			Schema:      schema,
+		})
+		return nil
+	})
+	return params, err
+}
+
+// form 生成表单请求体的 schema，字段名使用 form tag，表单的字段不能嵌套，直接生成对象而不是引用
+func (g *schemaGenerator) form(t reflect.Type) (*openAPISchema, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("form body needs a struct, got %s", t)
+	}
+	schema := &openAPISchema{Type: "object", Properties: make(map[string]*openAPISchema)}
+	err := eachField(t, "form", func(field reflect.StructField, name string, required bool) error {
+		prop, err := g.schema(field.Type)
+		if err != nil {
+			return err
+		}
+		prop.Description = field.Tag.Get("description")
+		schema.Properties[name] = prop
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// eachField 按照 tag 遍历结构体导出的字段，tag 的格式和 json tag 一样，eg: `query:"page,omitempty"`
+// 没有 tag 的嵌入结构体展开，omitempty 和指针类型的字段不是必填的
+func eachField(t reflect.Type, tagKey string, fn func(field reflect.StructField, name string, required bool) error) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get(tagKey)
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if err := eachField(ft, tagKey, fn); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		required := field.Type.Kind() != reflect.Ptr && !strings.Contains(opts, "omitempty")
+		if err := fn(field, name, required); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeOpenAPI 在 SpecPath 提供 OpenAPI 文档，UIPath 不为空时同时提供文档查看页面
+// 文档在每次请求时根据当前的路由生成，这两个路由本身不会出现在文档中
+// 文档的路由会覆盖同一个地址上已经注册的路由，所以 UIPath 为 / 或者和已经注册的 GET 路由冲突时 panic
+func (engine *Engine) ServeOpenAPI(conf OpenAPIConfig) {
+	if conf.SpecPath == "" {
+		conf.SpecPath = "/openapi.json"
+	}
+	base := strings.TrimSuffix(conf.UIPath, "/")
+	if conf.UIPath != "" && base == "" {
+		panic("gambler: openapi UIPath cannot be /, it would replace the app's index route")
+	}
+	engine.mustBeFreeRoute(http.MethodGet, conf.SpecPath)
+	if base != "" {
+		engine.mustBeFreeRoute(http.MethodGet, base)
+		engine.mustBeFreeRoute(http.MethodGet, base+"/assets/*filepath")
+	}
+	engine.GET(conf.SpecPath, func(c *Context) {
+		spec, err := engine.OpenAPI(conf)
+		if err != nil {
+			c.Logger().Error("generate openapi failed", F("error", err))
+			c.Fail(http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		c.SetHeader("Content-Type", "application/json; charset=utf-8")
+		c.Data(http.StatusOK, spec)
+	}).Hide()
+	engine.logger.Debug("openapi spec served", F("path", conf.SpecPath))
+	if conf.UIPath == "" {
+		return
+	}
+
+	title := conf.Title
+	if title == "" {
+		title = "API"
+	}
+	page := func(c *Context) {
+		c.SetHeader("Content-Type", "text/html; charset=utf-8")
+		c.SetStatus(http.StatusOK)
+		err := openAPIUITemplate.Execute(c.Writer, map[string]string{"Title": title, "Base": base, "SpecURL": conf.SpecPath})
+		if err != nil {
+			c.Logger().Error("render openapi ui failed", F("error", err))
+		}
+	}
+	assets := http.FileServer(http.FS(openAPIUI))
+	// 路由匹配时忽略末尾的 /，/docs 和 /docs/ 都会匹配到这个路由
+	engine.GET(base, page).Hide()
+	engine.GET(base+"/assets/*filepath", func(c *Context) {
+		file := path.Clean("/" + c.GetParam("filepath"))
+		if file != "/viewer.js" && file != "/viewer.css" {
+			c.Fail(http.StatusNotFound, "404 NOT FOUND")
+			return
+		}
+		req := c.Req.Clone(c.Req.Context())
+		req.URL.Path = "/openapiui" + file
+		assets.ServeHTTP(c.Writer, req)
+	}).Hide()
+	engine.logger.Debug("openapi ui served", F("path", conf.UIPath))
+}
+
+// mustBeFreeRoute 地址上已经注册了路由时 panic，参数名不同的同一个路由也算冲突，eg: /docs/:id 和 /docs/:name
+func (engine *Engine) mustBeFreeRoute(method string, pattern string) {
+	key := routeShape(pattern)
+	for _, route := range engine.routes {
+		if route.Method == method && routeShape(route.Path) == key {
+			panic(fmt.Sprintf("gambler: openapi route %s %s conflicts with registered route %s", method, pattern, route.Path))
+		}
+	}
+}
+
+// routeShape 去掉参数名和末尾的 /，路由树中形状相同的路由会互相覆盖
+func routeShape(pattern string) string {
+	parts := parsePattern(pattern)
+	for i, part := range parts {
+		if part[0] == ':' || part[0] == '*' {
+			parts[i] = part[:1]
+		}
+	}
+	return "/" + strings.Join(parts, "/")
+}
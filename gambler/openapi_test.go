@@ -0,0 +1,197 @@
+package gambler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type openAPITestBase struct {
+	ID      int64     `json:"id"`
+	Created time.Time `json:"created"`
+}
+
+type openAPITestUser struct {
+	openAPITestBase
+	Name    string            `json:"name" description:"用户名"`
+	Email   *string           `json:"email"`
+	Tags    []string          `json:"tags,omitempty"`
+	Extra   map[string]int    `json:"extra,omitempty"`
+	Friends []openAPITestUser `json:"friends,omitempty"`
+	secret  string
+	Ignored string `json:"-"`
+}
+
+type openAPITestQuery struct {
+	Page int    `query:"page,omitempty" description:"页码"`
+	Sort string `query:"sort"`
+}
+
+func TestOpenAPI(t *testing.T) {
+	r := New()
+	r.SetLogger(nil)
+	handler := func(c *Context) {}
+	r.GET("/users", handler).Name("listUsers").Tags("user").QueryParams(openAPITestQuery{}).
+		Response(http.StatusOK, []openAPITestUser{})
+	r.PUT("/users/:id", handler).Summary("修改用户").Tags("user").Param("path", "id", "用户 ID").
+		Body(openAPITestUser{}).Response(http.StatusOK, openAPITestUser{}).Response(http.StatusNotFound, nil)
+	r.Static("/assets", ".")
+	r.GET("/internal", handler).Hide()
+	r.ServeOpenAPI(OpenAPIConfig{Title: "test", Version: "2.0", SpecPath: "/openapi.json", UIPath: "/docs"})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Fatalf("unexpected response %d %v", w.Code, w.Header())
+	}
+	var doc openAPIDocument
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != "3.1.0" || doc.Info.Title != "test" || doc.Info.Version != "2.0" {
+		t.Fatalf("unexpected info %+v", doc)
+	}
+	if len(doc.Paths) != 3 || doc.Paths["/internal"] != nil || doc.Paths["/openapi.json"] != nil || doc.Paths["/docs"] != nil {
+		t.Fatalf("unexpected paths %v", doc.Paths)
+	}
+	if op := doc.Paths["/assets/{filepath}"]["get"]; op == nil || len(op.Parameters) != 1 || op.Responses["200"] == nil {
+		t.Fatalf("static route should have a path param, got %+v", op)
+	}
+
+	list := doc.Paths["/users"]["get"]
+	if list.OperationID != "listUsers" || len(list.Parameters) != 2 {
+		t.Fatalf("unexpected list operation %+v", list)
+	}
+	if page := list.Parameters[0]; page.Name != "page" || page.In != "query" || page.Required || page.Schema.Type != "integer" || page.Description != "页码" {
+		t.Fatalf("unexpected query param %+v", page)
+	}
+	if !list.Parameters[1].Required {
+		t.Fatalf("sort should be required")
+	}
+	if schema := list.Responses["200"].Content["application/json"].Schema; schema.Type != "array" || schema.Items.Ref != "#/components/schemas/openAPITestUser" {
+		t.Fatalf("unexpected list schema %+v", schema)
+	}
+
+	update := doc.Paths["/users/{id}"]["put"]
+	if update.Summary != "修改用户" || len(update.Parameters) != 1 || update.Parameters[0].Description != "用户 ID" || !update.Parameters[0].Required {
+		t.Fatalf("unexpected update operation %+v", update)
+	}
+	if update.RequestBody == nil || update.Responses["404"].Description != "Not Found" || update.Responses["404"].Content != nil {
+		t.Fatalf("unexpected update body or responses %+v", update)
+	}
+
+	user := doc.Components.Schemas["openAPITestUser"]
+	want := []string{"id", "created", "name", "email", "tags", "extra", "friends"}
+	if len(user.Properties) != len(want) {
+		t.Fatalf("unexpected properties %v", user.Properties)
+	}
+	for _, name := range want {
+		if user.Properties[name] == nil {
+			t.Fatalf("missing property %s", name)
+		}
+	}
+	if strings.Join(user.Required, ",") != "id,created,name" {
+		t.Fatalf("unexpected required %v", user.Required)
+	}
+	if user.Properties["created"].Format != "date-time" || user.Properties["name"].Description != "用户名" ||
+		user.Properties["extra"].AdditionalProperties.Type != "integer" ||
+		user.Properties["friends"].Items.Ref != "#/components/schemas/openAPITestUser" {
+		t.Fatalf("unexpected properties %+v", user.Properties)
+	}
+}
+
+func TestOpenAPIUI(t *testing.T) {
+	r := New()
+	r.SetLogger(nil)
+	r.ServeOpenAPI(OpenAPIConfig{SpecPath: "/api/openapi.json", UIPath: "/docs/"})
+	cases := []struct {
+		url      string
+		code     int
+		contains string
+	}{
+		{"/docs", http.StatusOK, `data-spec="/api/openapi.json"`},
+		{"/docs/", http.StatusOK, `src="/docs/assets/viewer.js"`},
+		{"/docs/assets/viewer.js", http.StatusOK, "data-spec"},
+		{"/docs/assets/viewer.css", http.StatusOK, ".method"},
+		{"/docs/assets/index.html", http.StatusNotFound, ""},
+		{"/docs/assets/../index.html", http.StatusNotFound, ""},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", tc.url, nil))
+		if w.Code != tc.code || !strings.Contains(w.Body.String(), tc.contains) {
+			t.Fatalf("%s: want %d containing %q, got %d %q", tc.url, tc.code, tc.contains, w.Code, w.Body.String())
+		}
+	}
+}
+
+type openAPITestLogin struct {
+	UserName string  `form:"userName" description:"用户名"`
+	Remember *bool   `form:"remember"`
+	Ignored  string  `form:"-"`
+	Scores   []int64 `form:"scores,omitempty"`
+}
+
+func TestOpenAPIFormBody(t *testing.T) {
+	r := New()
+	r.SetLogger(nil)
+	r.POST("/login", func(c *Context) {}).FormBody(openAPITestLogin{})
+	spec, err := r.OpenAPI(OpenAPIConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc openAPIDocument
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		t.Fatal(err)
+	}
+	body := doc.Paths["/login"]["post"].RequestBody
+	if body == nil || len(body.Content) != 1 {
+		t.Fatalf("unexpected request body %+v", body)
+	}
+	schema := body.Content["application/x-www-form-urlencoded"].Schema
+	if schema == nil || schema.Type != "object" || len(schema.Properties) != 3 || strings.Join(schema.Required, ",") != "userName" {
+		t.Fatalf("unexpected form schema %+v", schema)
+	}
+	if schema.Properties["userName"].Description != "用户名" || schema.Properties["scores"].Items.Type != "integer" {
+		t.Fatalf("unexpected form properties %+v", schema.Properties)
+	}
+	if doc.Components != nil {
+		t.Fatalf("form body should not add components, got %+v", doc.Components)
+	}
+}
+
+func TestOpenAPIRouteConflict(t *testing.T) {
+	handler := func(c *Context) {}
+	cases := []struct {
+		name  string
+		setup func(r *Engine)
+		conf  OpenAPIConfig
+	}{
+		{"root ui", func(r *Engine) {}, OpenAPIConfig{UIPath: "/"}},
+		{"ui", func(r *Engine) { r.GET("/docs/", handler) }, OpenAPIConfig{UIPath: "/docs"}},
+		{"assets", func(r *Engine) { r.GET("/docs/assets/*file", handler) }, OpenAPIConfig{UIPath: "/docs"}},
+		{"spec", func(r *Engine) { r.GET("/openapi.json", handler) }, OpenAPIConfig{}},
+	}
+	for _, tc := range cases {
+		func() {
+			r := New()
+			r.SetLogger(nil)
+			tc.setup(r)
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("%s: conflicting openapi route should panic", tc.name)
+				}
+			}()
+			r.ServeOpenAPI(tc.conf)
+		}()
+	}
+
+	r := New()
+	r.SetLogger(nil)
+	r.GET("/", handler)
+	r.POST("/docs", handler)
+	r.ServeOpenAPI(OpenAPIConfig{UIPath: "/docs"})
+}
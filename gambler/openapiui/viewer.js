@@ -0,0 +1,129 @@
+// openapiui/viewer.js: 离线的 OpenAPI 文档查看页面，读取 data-spec 指定的文档，按照 tag 分组显示所有接口
+(function () {
+  "use strict";
+  var app = document.getElementById("app");
+
+  // el 创建元素，children 可以是字符串或者元素
+  function el(tag, attrs, children) {
+    var node = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function (key) { node.setAttribute(key, attrs[key]); });
+    (children || []).forEach(function (child) {
+      node.appendChild(typeof child === "string" ? document.createTextNode(child) : child);
+    });
+    return node;
+  }
+
+  // resolve 解析 components 中的引用
+  function resolve(spec, schema) {
+    var seen = 0;
+    while (schema && schema.$ref && seen++ < 32) {
+      var name = schema.$ref.replace("#/components/schemas/", "");
+      schema = (spec.components && spec.components.schemas || {})[name];
+    }
+    return schema || {};
+  }
+
+  // example 根据 schema 生成示例值，depth 防止递归的类型无限展开
+  function example(spec, schema, depth) {
+    schema = resolve(spec, schema);
+    if (depth > 6) { return null; }
+    switch (schema.type) {
+      case "object":
+        var obj = {};
+        Object.keys(schema.properties || {}).forEach(function (key) {
+          obj[key] = example(spec, schema.properties[key], depth + 1);
+        });
+        if (schema.additionalProperties) { obj.key = example(spec, schema.additionalProperties, depth + 1); }
+        return obj;
+      case "array": return [example(spec, schema.items, depth + 1)];
+      case "integer": case "number": return 0;
+      case "boolean": return false;
+      case "string": return schema.format === "date-time" ? new Date(0).toISOString() : "string";
+    }
+    return null;
+  }
+
+  // typeName 显示参数的类型
+  function typeName(spec, schema) {
+    if (schema && schema.$ref) { return schema.$ref.replace("#/components/schemas/", ""); }
+    schema = schema || {};
+    if (schema.type === "array") { return typeName(spec, schema.items) + "[]"; }
+    return (schema.type || "any") + (schema.format ? " (" + schema.format + ")" : "");
+  }
+
+  function content(spec, body) {
+    var media = body && body.content && body.content["application/json"];
+    if (!media) { return null; }
+    return el("pre", {}, [JSON.stringify(example(spec, media.schema, 0), null, 2)]);
+  }
+
+  function operation(spec, path, method, op) {
+    var cls = ["get", "post", "put", "patch", "delete"].indexOf(method) >= 0 ? method : "other";
+    var body = el("div", {});
+    if (op.description) { body.appendChild(el("p", { "class": "desc" }, [op.description])); }
+    if (op.parameters && op.parameters.length) {
+      var rows = op.parameters.map(function (p) {
+        return el("tr", {}, [
+          el("td", {}, [el("code", {}, [p.name]), p.required ? el("span", { "class": "required" }, [" *"]) : ""]),
+          el("td", {}, [p.in]),
+          el("td", {}, [typeName(spec, p.schema)]),
+          el("td", {}, [p.description || ""])
+        ]);
+      });
+      body.appendChild(el("h4", {}, ["Parameters"]));
+      body.appendChild(el("table", {}, [el("tr", {}, [el("th", {}, ["Name"]), el("th", {}, ["In"]), el("th", {}, ["Type"]), el("th", {}, ["Description"])])].concat(rows)));
+    }
+    var request = content(spec, op.requestBody);
+    if (request) {
+      body.appendChild(el("h4", {}, ["Request body"]));
+      body.appendChild(request);
+    }
+    body.appendChild(el("h4", {}, ["Responses"]));
+    Object.keys(op.responses || {}).sort().forEach(function (code) {
+      var resp = op.responses[code];
+      body.appendChild(el("p", {}, [el("strong", {}, [code]), " " + (resp.description || "")]));
+      var respBody = content(spec, resp);
+      if (respBody) { body.appendChild(respBody); }
+    });
+    return el("details", { "class": "op" }, [
+      el("summary", {}, [
+        el("span", { "class": "method " + cls }, [method]),
+        el("span", { "class": "path" }, [path]),
+        el("span", { "class": "summary" }, [op.summary || ""])
+      ]),
+      body
+    ]);
+  }
+
+  function render(spec) {
+    var info = spec.info || {};
+    var groups = {};
+    Object.keys(spec.paths || {}).sort().forEach(function (path) {
+      Object.keys(spec.paths[path]).forEach(function (method) {
+        var op = spec.paths[path][method];
+        (op.tags && op.tags.length ? op.tags : ["default"]).forEach(function (tag) {
+          (groups[tag] = groups[tag] || []).push(operation(spec, path, method, op));
+        });
+      });
+    });
+    app.innerHTML = "";
+    app.appendChild(el("h1", {}, [info.title || "API", " ", el("small", {}, [info.version || "", " · OpenAPI " + spec.openapi])]));
+    if (info.description) { app.appendChild(el("p", { "class": "desc" }, [info.description])); }
+    (spec.servers || []).forEach(function (server) { app.appendChild(el("p", {}, ["Server: ", el("code", {}, [server.url])])); });
+    Object.keys(groups).sort().forEach(function (tag) {
+      app.appendChild(el("h2", {}, [tag]));
+      groups[tag].forEach(function (node) { app.appendChild(node); });
+    });
+  }
+
+  fetch(app.getAttribute("data-spec"))
+    .then(function (resp) {
+      if (!resp.ok) { throw new Error(resp.status + " " + resp.statusText); }
+      return resp.json();
+    })
+    .then(render)
+    .catch(function (err) {
+      app.innerHTML = "";
+      app.appendChild(el("p", { "class": "error" }, ["Failed to load the specification: " + err.message]));
+    });
+})();
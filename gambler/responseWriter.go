@@ -0,0 +1,86 @@
+package gambler
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// responseWriter.go: 包装 http.ResponseWriter，记录真正写出的状态码和字节数
+// 访问日志等中间件需要知道响应的状态码和大小，而静态文件等 handler 是直接通过 http.FileServer 写响应的，不会经过 Context.SetStatus
+
+// responseWriter Context 的 Writer 默认就是它
+type responseWriter struct {
+	http.ResponseWriter
+	status      int  // 写出的状态码，没有调用 WriteHeader 时为 200
+	size        int  // 写出的 body 字节数
+	wroteHeader bool // 是否已经写出响应头
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+// WriteHeader 只有第一次调用生效，避免 net/http 打印 superfluous WriteHeader
+func (w *responseWriter) WriteHeader(code int) {
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		// 1xx 的信息响应(eg: 103 Early Hints)之后还会有最终的响应，不记录
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.wroteHeader {
+		return
+	}
+	w.status = code
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.size += n
+	return n, err
+}
+
+// Flush 支持流式响应
+func (w *responseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack 支持 websocket 等需要接管连接的场景
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("gambler: ResponseWriter does not implement http.Hijacker")
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap 供 http.ResponseController 找到原始的 ResponseWriter
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status 返回写出的状态码
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+// Size 返回写出的 body 字节数
+func (w *responseWriter) Size() int {
+	return w.size
+}
+
+// Written 是否已经写出了响应头
+func (w *responseWriter) Written() bool {
+	return w.wroteHeader
+}
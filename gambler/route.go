@@ -0,0 +1,118 @@
+package gambler
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+)
+
+// route.go: 命名路由和反向生成 URL
+// 注册路由时命名，模板和代码中通过名字生成地址，修改路由时不需要修改所有写死的链接
+// eg: r.GET("/hello/:name", handler).Name("hello")
+// r.URL("hello", "name", "liup2", "page", 2) -> /hello/liup2?page=2
+// 模板中：{{ url "hello" "name" .Name }}，需要先 AddFuncMap(r.URLFuncMap())
+
+// 生成 URL 的错误
+var (
+	ErrRouteNotFound = errors.New("gambler: no route with this name")
+	errURLParams     = errors.New("gambler: url params need key and value pairs")
+)
+
+// Route 注册的路由
+type Route struct {
+	Method  string // 请求方式，eg: GET
+	Path    string // 包含分组前缀的完整路由，eg: /hello/:name
+	name    string
+	engine  *Engine
+	handler HandlerFunc
+	doc     routeDoc // OpenAPI 文档中的描述
+}
+
+// Name 给路由命名，名字不能重复，同一个路由再次命名时之前的名字仍然有效
+func (route *Route) Name(name string) *Route {
+	if name == "" {
+		panic("gambler: route name is empty")
+	}
+	if old, ok := route.engine.namedRoutes[name]; ok {
+		panic(fmt.Sprintf("gambler: route name %q already used by %s %s", name, old.Method, old.Path))
+	}
+	route.name = name
+	route.engine.namedRoutes[name] = route
+	route.engine.logger.Debug("route named", F("name", name), F("method", route.Method), F("path", route.Path))
+	return route
+}
+
+// URL 根据路由的名字生成地址，params 是 key、value 交替的参数
+// 路由中的 :param 和 *catch-all 使用同名参数的值填充并做 URL 转义，catch-all 中的 / 会保留
+// 其他参数作为查询字符串，eg: URL("file", "filepath", "css/a b.css", "v", 2) -> /assets/css/a%20b.css?v=2
+func (engine *Engine) URL(name string, params ...interface{}) (string, error) {
+	route, ok := engine.namedRoutes[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrRouteNotFound, name)
+	}
+	if len(params)%2 != 0 {
+		return "", errURLParams
+	}
+	values := make(map[string]string, len(params)/2)
+	keys := make([]string, 0, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		key, ok := params[i].(string)
+		if !ok {
+			return "", fmt.Errorf("gambler: url param key %v is not a string", params[i])
+		}
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = fmt.Sprint(params[i+1])
+	}
+
+	var b strings.Builder
+	parts := parsePattern(route.Path)
+	for _, part := range parts {
+		b.WriteByte('/')
+		if part[0] != ':' && part[0] != '*' {
+			b.WriteString(part)
+			continue
+		}
+		key := part[1:]
+		value, ok := values[key]
+		if key == "" || !ok {
+			return "", fmt.Errorf("gambler: route %q needs param %q", name, key)
+		}
+		delete(values, key)
+		if part[0] == ':' {
+			b.WriteString(url.PathEscape(value))
+			continue
+		}
+		// catch-all 按照 / 分段转义
+		segments := strings.Split(strings.TrimPrefix(value, "/"), "/")
+		for i, segment := range segments {
+			segments[i] = url.PathEscape(segment)
+		}
+		b.WriteString(strings.Join(segments, "/"))
+	}
+	if len(parts) == 0 || (strings.HasSuffix(route.Path, "/") && parts[len(parts)-1][0] != '*') {
+		b.WriteByte('/')
+	}
+
+	// 路由中没有用到的参数按照传入的顺序放到查询字符串中
+	var query []string
+	for _, key := range keys {
+		if value, ok := values[key]; ok {
+			query = append(query, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+	if len(query) > 0 {
+		b.WriteByte('?')
+		b.WriteString(strings.Join(query, "&"))
+	}
+	return b.String(), nil
+}
+
+// URLFuncMap 返回 url 模板函数，需要在 LoadHTMLGlob 之前通过 AddFuncMap 注册
+// eg: <link rel="stylesheet" href="{{ url "assets" "filepath" "css/IndexPage.css" }}">
+func (engine *Engine) URLFuncMap() template.FuncMap {
+	return template.FuncMap{"url": engine.URL}
+}
@@ -0,0 +1,127 @@
+package gambler
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// routeTable.go: 查看注册的路由，debug 模式下启动时输出路由表，还可以挂载调试接口查看
+// eg: debug := r.NewGroup("/debug"); debug.UseMiddlewares(MiddlewareBasicAuth(accounts)); debug.GET("/routes", r.RoutesHandler())
+// 浏览器中显示 HTML 表格，?format=json 或者 Accept: application/json 时返回 JSON
+// 调试接口会暴露所有的路由，需要放在有认证的分组中，或者只在 IsDebugging() 时挂载
+
+// RouteInfo 路由的信息
+type RouteInfo struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`                  // 包含分组前缀的完整路由，eg: /hello/:name
+	Name        string   `json:"name,omitempty"`        // 通过 Route.Name 设置的名字
+	Handler     string   `json:"handler"`               // handler 的函数名，eg: main.main.func1
+	Middlewares []string `json:"middlewares,omitempty"` // 请求这个路由时执行的分组中间件，按执行顺序
+}
+
+// Routes 返回所有的路由，按照路径和请求方式排序，同一个路由注册多次时只返回最后一次注册的
+func (engine *Engine) Routes() []RouteInfo {
+	registered := engine.registeredRoutes()
+	routes := make([]RouteInfo, 0, len(registered))
+	for _, route := range registered {
+		info := RouteInfo{
+			Method:  route.Method,
+			Path:    route.Path,
+			Name:    route.name,
+			Handler: nameOfFunction(route.handler),
+		}
+		// 和 ServeHTTP 一样，按照分组的前缀收集中间件
+		for _, group := range engine.groups {
+			if strings.HasPrefix(route.Path, group.prefix) {
+				for _, middleware := range group.middlewares {
+					info.Middlewares = append(info.Middlewares, nameOfFunction(middleware))
+				}
+			}
+		}
+		routes = append(routes, info)
+	}
+	return routes
+}
+
+// registeredRoutes 返回生效的路由，同一个路由注册多次时只保留最后一次注册的，按照路径和请求方式排序
+func (engine *Engine) registeredRoutes() []*Route {
+	seen := make(map[string]bool, len(engine.routes))
+	routes := make([]*Route, 0, len(engine.routes))
+	for i := len(engine.routes) - 1; i >= 0; i-- {
+		route := engine.routes[i]
+		key := route.Method + "-" + route.Path
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// nameOfFunction 返回函数的名字，eg: gambler.MiddlewareLogger.func1
+func nameOfFunction(f interface{}) string {
+	v := reflect.ValueOf(f)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+	if fn := runtime.FuncForPC(v.Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return ""
+}
+
+// logRoutes debug 模式下启动时输出路由表，每个路由一行
+func (engine *Engine) logRoutes() {
+	if !engine.logger.Enabled(LevelDebug) {
+		return
+	}
+	routes := engine.Routes()
+	width := 0
+	for _, route := range routes {
+		if len(route.Path) > width {
+			width = len(route.Path)
+		}
+	}
+	for _, route := range routes {
+		engine.logger.Debug(fmt.Sprintf("%-7s %-*s --> %s (%d middlewares)", route.Method, width, route.Path, route.Handler, len(route.Middlewares)))
+	}
+}
+
+// routesTemplate 调试接口的 HTML 页面
+var routesTemplate = template.Must(template.New("routes").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Routes</title>
+<style>body{font-family:sans-serif}table{border-collapse:collapse}th,td{border:1px solid #ccc;padding:4px 8px;text-align:left}td{font-family:monospace}</style>
+</head><body><h1>Routes ({{ len . }})</h1>
+<table><tr><th>Method</th><th>Path</th><th>Name</th><th>Handler</th><th>Middlewares</th></tr>
+{{ range . }}<tr><td>{{ .Method }}</td><td>{{ .Path }}</td><td>{{ .Name }}</td><td>{{ .Handler }}</td><td>{{ range $i, $m := .Middlewares }}{{ if $i }}<br>{{ end }}{{ $m }}{{ end }}</td></tr>
+{{ end }}</table></body></html>
+`))
+
+// RoutesHandler 返回查看路由表的 handler，默认返回 HTML 页面，?format=json 或者 Accept 中有 application/json 时返回 JSON
+func (engine *Engine) RoutesHandler() HandlerFunc {
+	return func(c *Context) {
+		routes := engine.Routes()
+		if c.Query("format") == "json" || strings.Contains(c.Req.Header.Get("Accept"), "application/json") {
+			c.SetHeader("Content-Type", "application/json; charset=utf-8")
+			c.JSON(http.StatusOK, routes)
+			return
+		}
+		c.SetHeader("Content-Type", "text/html; charset=utf-8")
+		c.SetStatus(http.StatusOK)
+		if err := routesTemplate.Execute(c.Writer, routes); err != nil {
+			c.Logger().Error("render routes failed", F("error", err))
+		}
+	}
+}
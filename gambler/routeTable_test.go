@@ -0,0 +1,52 @@
+package gambler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRoutes(t *testing.T) {
+	r := New()
+	r.SetLogger(nil)
+	r.UseMiddlewares(MiddlewareRecover())
+	r.GET("/hello/:name", func(c *Context) {}).Name("hello")
+	api := r.NewGroup("/api")
+	api.UseMiddlewares(MiddlewareRequestID())
+	api.POST("/users", func(c *Context) {})
+	// 重复注册时只保留最后一次
+	api.POST("/users", testRoutesHandler)
+	r.GET("/debug/routes", r.RoutesHandler())
+
+	routes := r.Routes()
+	if len(routes) != 3 {
+		t.Fatalf("want 3 routes, got %+v", routes)
+	}
+	users := routes[0]
+	if users.Method != "POST" || users.Path != "/api/users" || users.Handler != "gambler.testRoutesHandler" {
+		t.Fatalf("unexpected route %+v", users)
+	}
+	if len(users.Middlewares) != 2 || !strings.Contains(users.Middlewares[0], "MiddlewareRecover") ||
+		!strings.Contains(users.Middlewares[1], "MiddlewareRequestID") {
+		t.Fatalf("unexpected middlewares %v", users.Middlewares)
+	}
+	if hello := routes[2]; hello.Path != "/hello/:name" || hello.Name != "hello" || len(hello.Middlewares) != 1 {
+		t.Fatalf("unexpected route %+v", hello)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/debug/routes?format=json", nil))
+	var got []RouteInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || len(got) != 3 || got[0].Path != "/api/users" {
+		t.Fatalf("unexpected json %q: %v", w.Body.String(), err)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/debug/routes", nil))
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") || !strings.Contains(w.Body.String(), "<td>/hello/:name</td>") {
+		t.Fatalf("unexpected html %q", w.Body.String())
+	}
+}
+
+func testRoutesHandler(c *Context) {}
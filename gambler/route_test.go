@@ -0,0 +1,70 @@
+package gambler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestURL(t *testing.T) {
+	r := New()
+	r.SetLogger(nil)
+	handler := func(c *Context) {}
+	r.GET("/", handler).Name("index")
+	r.GET("/hello/:name", handler).Name("hello")
+	r.StaticFS("/assets", fstest.MapFS{}).Name("assets")
+	g := r.NewGroup("/g2")
+	g.GET("/", handler).Name("g2")
+	g.POST("/users/:id/posts/:post", handler).Name("post")
+
+	cases := []struct {
+		name   string
+		params []interface{}
+		want   string
+	}{
+		{"index", nil, "/"},
+		{"hello", []interface{}{"name", "liup2"}, "/hello/liup2"},
+		{"hello", []interface{}{"name", "a b/c", "page", 2, "q", "x&y"}, "/hello/a%20b%2Fc?page=2&q=x%26y"},
+		{"assets", []interface{}{"filepath", "css/Index Page.css"}, "/assets/css/Index%20Page.css"},
+		{"g2", nil, "/g2/"},
+		{"post", []interface{}{"post", 7, "id", 42}, "/g2/users/42/posts/7"},
+	}
+	for _, tc := range cases {
+		got, err := r.URL(tc.name, tc.params...)
+		if err != nil || got != tc.want {
+			t.Fatalf("%s %v: want %q, got %q %v", tc.name, tc.params, tc.want, got, err)
+		}
+	}
+
+	if _, err := r.URL("missing"); !errors.Is(err, ErrRouteNotFound) {
+		t.Fatalf("unknown route should fail, got %v", err)
+	}
+	for _, params := range [][]interface{}{nil, {"name"}, {1, "liup2"}} {
+		if _, err := r.URL("hello", params...); err == nil {
+			t.Fatalf("params %v should fail", params)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("duplicate route name should panic")
+		}
+	}()
+	r.GET("/other", handler).Name("hello")
+}
+
+func TestURLFuncMap(t *testing.T) {
+	r := New()
+	r.SetFuncMap(r.URLFuncMap())
+	r.LoadHTMLFS(fstest.MapFS{"page.tmpl": {Data: []byte(`<a href="{{ url "hello" "name" . }}">`)}}, "*.tmpl")
+	r.GET("/hello/:name", func(c *Context) {
+		c.HTML(http.StatusOK, "page.tmpl", "liu p2")
+	}).Name("hello")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/hello/x", nil))
+	if want := `<a href="/hello/liu%20p2">`; w.Body.String() != want {
+		t.Fatalf("want %q, got %q", want, w.Body.String())
+	}
+}
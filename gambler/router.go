@@ -1,7 +1,6 @@
 package gambler
 
 import (
-	"log"
 	"net/http"
 	"strings"
 )
@@ -14,15 +13,15 @@ import (
 type router struct {
 	roots    map[string]*node       // 存储每种请求方式的 Trie 树根节点
 	handlers map[string]HandlerFunc // 存储每个路由对应的 HandlerFunc
+	logger   Logger                 // 由 engine 设置，单独使用 router 时不输出日志
 }
 
 // NewRouter 提供路由实例的创建函数
 func NewRouter() *router {
-	log.Printf("Debug msg : router.go -> NewRouter : create router with roots, handlers\n")
-	log.Printf("CREATE NewRouter FINISH\n")
 	return &router{
 		roots:    make(map[string]*node),
 		handlers: make(map[string]HandlerFunc),
+		logger:   nopLogger{},
 	}
 }
 
@@ -48,7 +47,6 @@ func parsePattern(pattern string) []string {
 
 // addRouter 功能是添加路由，也就是添加前缀树的节点
 func (r *router) addRouter(method string, pattern string, handler HandlerFunc) {
-	log.Printf("Debug msg : router.go -> addRouter : method = %v, pattern = %v\n", method, pattern)
 	_, ok := r.roots[method]
 	// 如果该方法还没有 tire 树则创建
 	if !ok {
@@ -57,7 +55,7 @@ func (r *router) addRouter(method string, pattern string, handler HandlerFunc) {
 	// 将该节点插入到 tire 树中，并设置 handler
 	parts := parsePattern(pattern)
 	key := method + "-" + pattern
-	log.Printf("Debug msg : router.go -> addRouter : parsePattern res is : parts = %v, key = %v\n", parts, key)
+	r.logger.Debug("trie node inserted", F("key", key), F("parts", parts))
 	r.roots[method].insert(pattern, parts, 0)
 	r.handlers[key] = handler
 }
@@ -67,24 +65,19 @@ func (r *router) addRouter(method string, pattern string, handler HandlerFunc) {
 // eg: searchParts:/p/go/doc, nodeParts:/p/:lang/doc, 解析结果为：{lang: "go"}
 // eg: static/css/geektutu.css匹配到/static/*filepath，解析结果为{filepath: "css/indexpage.css"}
 func (r *router) getRoute(method string, path string) (*node, map[string]string) {
-	log.Printf("Debug msg : router.go -> getRoute : method = %v, path = %v\n", method, path)
 	params := make(map[string]string)
 	// 尝试得到对应请求方式的 前缀树根节点
 	root, ok := r.roots[method]
-	log.Printf("Debug msg : router.go -> getRoute :get method root = %v\n", root)
 	if !ok {
 		return nil, nil
 	}
 	// 解析请求路径得到 parts
 	searchParts := parsePattern(path)
-	log.Printf("Debug msg : router.go -> getRoute : get searchParts from path = %v\n", searchParts)
 	// 成功拿到对应请求的前缀树后查找匹配当前路径的节点
 	n := root.search(searchParts, 0)
-	log.Printf("Debug msg : router.go -> getRoute : get node = %v\n", n)
 	if n != nil {
 		// 解析这个节点的路径
 		parts := parsePattern(n.pattern)
-		log.Printf("Debug msg : router.go -> getRoute : get node parts = %v\n", parts)
 		// 准备解析的结果，用 params 保存，key 是 节点， value 是 路径
 		// 利用 index 实现对应
 		for index, part := range parts {
@@ -123,9 +116,9 @@ func (r *router) getRoutes(method string) []*node {
 func (r *router) handle(c *Context) {
 	// 拿到前缀树的节点
 	n, params := r.getRoute(c.Method, c.Path)
-	log.Printf("Debug msg : router.go -> handle : node = %v\n", n)
 	if n != nil {
 		c.Params = params
+		c.fullPath = n.pattern
 		key := c.Method + "-" + n.pattern
 		// r.handlers[key] 是和当前路由对应的 handlerFunc
 		// 这一步骤是将与这个路由匹配的 handler 函数添加到 handlers 列表中
@@ -136,7 +129,10 @@ func (r *router) handle(c *Context) {
 			c.String(http.StatusNotFound, "404 NOT FOUND : %s\n", c.Path)
 		})
 	}
-	log.Printf("Debug msg : router.go -> handle : nums of handlers = %d\n", len(c.handlers))
+	// 热路径上先判断级别，避免在非 debug 模式下构造字段
+	if r.logger.Enabled(LevelDebug) {
+		r.logger.Debug("route matched", F("method", c.Method), F("path", c.Path), F("node", n), F("handlers", len(c.handlers)))
+	}
 	// Next() 中从上下文的 handlers 列表中拿出中间件和 handler 执行
 	c.Next()
 }
@@ -144,13 +140,16 @@ func (r *router) handle(c *Context) {
 // showTree 展示某一路径的节点 node
 func (r *router) showTree(method string, path string) {
 	root, ok := r.roots[method]
-	log.Printf("Debug msg : router.go -> showTree : show root = %v\n", root)
 	if !ok {
-		log.Printf("Debug msg : router.go -> showTree : PATH NOT FOUND\n")
+		r.logger.Info("method not registered", F("method", method))
 		return
 	}
 	searchParts := parsePattern(path)
 	// 成功拿到对应请求的前缀树后查找匹配当前路径的节
 	node := root.search(searchParts, 0)
-	log.Printf("Debug msg : router.go -> showTree : node struct :\n\t node.pattern = %v\n\t node.part = %v\n\t node.children = %v\n\t node.isWild = %v\n\t", node.pattern, node.part, node.children, node.isWild)
+	if node == nil {
+		r.logger.Info("path not found", F("method", method), F("path", path))
+		return
+	}
+	r.logger.Info("trie node", F("pattern", node.pattern), F("part", node.part), F("children", node.children), F("isWild", node.isWild))
 }
@@ -0,0 +1,273 @@
+package gambler
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// server.go: Run 等方法创建的 http.Server 的配置和生命周期管理
+// http.ListenAndServe 创建的 Server 没有任何超时，慢速客户端(eg: 每隔几秒发送一个字节的请求头)可以一直占用连接
+// 收到 SIGINT/SIGTERM、ctx 被取消或者调用 Shutdown 时优雅关闭：不再接受新连接，等待正在处理的请求完成，超时后强制关闭
+
+// ErrServerRunning 同一个 Engine 同时只能运行一组 Server
+var ErrServerRunning = errors.New("gambler: server is already running")
+
+// ServerTimeouts http.Server 的超时设置，为 0 时不限制
+type ServerTimeouts struct {
+	ReadHeader time.Duration // 读取请求头的超时时间
+	Read       time.Duration // 读取整个请求(包括 body)的超时时间
+	Write      time.Duration // 从读取完请求头开始到写完响应的超时时间，会限制流式响应的总时长
+	Idle       time.Duration // keep-alive 连接等待下一个请求的超时时间，为 0 时使用 Read
+	Shutdown   time.Duration // 优雅关闭时等待正在处理的请求完成的最长时间
+}
+
+// DefaultServerTimeouts 返回默认的超时设置，只限制请求头和空闲连接，不影响上传大文件和流式响应
+func DefaultServerTimeouts() ServerTimeouts {
+	return ServerTimeouts{
+		ReadHeader: 10 * time.Second,
+		Idle:       2 * time.Minute,
+		Shutdown:   30 * time.Second,
+	}
+}
+
+// SetServerTimeouts 设置 Run 创建的 http.Server 的超时时间，需要在 Run 之前调用
+func (engine *Engine) SetServerTimeouts(timeouts ServerTimeouts) {
+	engine.timeouts = timeouts
+	engine.logger.Debug("server timeouts set",
+		F("readHeader", timeouts.ReadHeader), F("read", timeouts.Read), F("write", timeouts.Write),
+		F("idle", timeouts.Idle), F("shutdown", timeouts.Shutdown))
+}
+
+// newServer 创建监听 addr 的 http.Server
+func (engine *Engine) newServer(addr string) *http.Server {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           engine,
+		ReadHeaderTimeout: engine.timeouts.ReadHeader,
+		ReadTimeout:       engine.timeouts.Read,
+		WriteTimeout:      engine.timeouts.Write,
+		IdleTimeout:       engine.timeouts.Idle,
+	}
+	if engine.h2c {
+		// 设置了 Protocols 之后只支持其中的协议，HTTP/1.1 和 HTTPS 上的 HTTP/2 也要加上
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetHTTP2(true)
+		srv.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return srv
+}
+
+// serverState 正在运行的 Server 的状态和生命周期钩子
+type serverState struct {
+	mu         sync.Mutex
+	running    bool
+	stop       chan context.Context // Shutdown 通过它通知关闭，传递等待的截止时间
+	done       chan struct{}        // 关闭完成后 close
+	onStart    []func(ctx context.Context) error
+	onShutdown []func(ctx context.Context) error
+
+	restart      bool                    // 是否开启平滑重启
+	listenerKeys map[net.Listener]string // socket 对应的地址，重启时传给子进程
+	inherited    map[string]net.Listener // 父进程传入的还没有使用的 socket
+	inheritOnce  sync.Once
+}
+
+// OnStart 注册启动钩子，在开始监听之后、接受请求之前按注册顺序执行，返回错误时不再启动
+func (engine *Engine) OnStart(hook func(ctx context.Context) error) {
+	engine.state.mu.Lock()
+	defer engine.state.mu.Unlock()
+	engine.state.onStart = append(engine.state.onStart, hook)
+}
+
+// OnShutdown 注册关闭钩子，在请求处理完之后按注册的相反顺序执行，ctx 的截止时间是关闭的截止时间
+func (engine *Engine) OnShutdown(hook func(ctx context.Context) error) {
+	engine.state.mu.Lock()
+	defer engine.state.mu.Unlock()
+	engine.state.onShutdown = append(engine.state.onShutdown, hook)
+}
+
+// RunWithContext 监听 addr 并处理请求，直到 ctx 被取消、收到 SIGINT/SIGTERM 或者调用 Shutdown，然后优雅关闭
+// 优雅关闭成功时返回 nil
+func (engine *Engine) RunWithContext(ctx context.Context, addr string) error {
+	ln, err := engine.listen("tcp", addr, func() (net.Listener, error) {
+		return net.Listen("tcp", addr)
+	})
+	if err != nil {
+		return err
+	}
+	return engine.serve(ctx, managedServer{srv: engine.newServer(addr), ln: ln})
+}
+
+// Shutdown 优雅关闭正在运行的 Server，等待正在处理的请求完成，ctx 到期时强制关闭连接并返回 ctx 的错误
+// 没有正在运行的 Server 时直接返回
+func (engine *Engine) Shutdown(ctx context.Context) error {
+	engine.state.mu.Lock()
+	if !engine.state.running {
+		engine.state.mu.Unlock()
+		return nil
+	}
+	stop, done := engine.state.stop, engine.state.done
+	engine.state.mu.Unlock()
+	select {
+	case stop <- ctx:
+	default:
+		// 已经在关闭了
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// managedServer 一个 Server 和它监听的 listener
+type managedServer struct {
+	srv *http.Server
+	ln  net.Listener
+	tls bool // 是否使用 srv.TLSConfig 提供 HTTPS
+}
+
+func (s managedServer) serve() error {
+	if s.tls {
+		return s.srv.ServeTLS(s.ln, "", "")
+	}
+	return s.srv.Serve(s.ln)
+}
+
+// serve 运行所有的 Server，任意一个出错或者收到关闭信号时关闭所有的 Server
+func (engine *Engine) serve(ctx context.Context, servers ...managedServer) error {
+	state := &engine.state
+	state.mu.Lock()
+	if state.running {
+		state.mu.Unlock()
+		for _, s := range servers {
+			s.ln.Close()
+		}
+		return ErrServerRunning
+	}
+	state.running = true
+	state.stop = make(chan context.Context, 1)
+	state.done = make(chan struct{})
+	onStart := append([]func(context.Context) error(nil), state.onStart...)
+	restart := state.restart
+	state.mu.Unlock()
+	defer func() {
+		state.mu.Lock()
+		state.running = false
+		close(state.done)
+		state.mu.Unlock()
+	}()
+
+	engine.logRoutes()
+
+	// 在启动钩子之前监听信号，启动过程中收到的信号也会触发关闭
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	var restartSignal chan os.Signal
+	if restart {
+		restartSignal = make(chan os.Signal, 1)
+		signal.Notify(restartSignal, restartSignals...)
+		defer signal.Stop(restartSignal)
+	}
+
+	for _, hook := range onStart {
+		if err := hook(ctx); err != nil {
+			for _, s := range servers {
+				s.ln.Close()
+			}
+			return err
+		}
+	}
+
+	errs := make(chan error, len(servers))
+	for _, s := range servers {
+		engine.logger.Info("listening", F("addr", s.ln.Addr().String()), F("tls", s.tls))
+		go func(s managedServer) {
+			errs <- s.serve()
+		}(s)
+	}
+
+	// 平滑重启时由子进程通知父进程已经启动完成
+	engine.notifyReady()
+
+	var serveErr error
+	shutdownCtx := context.Background()
+wait:
+	for {
+		select {
+		case <-ctx.Done():
+			engine.logger.Info("shutting down", F("reason", ctx.Err()))
+		case sig := <-signals:
+			// 之后再收到信号时使用默认的处理方式，可以强制退出
+			signal.Stop(signals)
+			engine.logger.Info("shutting down", F("signal", sig.String()))
+		case shutdownCtx = <-state.stop:
+			engine.logger.Info("shutting down", F("reason", "Shutdown called"))
+		case serveErr = <-errs:
+			engine.logger.Error("server failed", F("error", serveErr))
+		case sig := <-restartSignal:
+			engine.logger.Info("restarting", F("signal", sig.String()))
+			if err := engine.restart(servers); err != nil {
+				engine.logger.Error("restart failed, keep serving", F("error", err))
+				continue
+			}
+		}
+		break wait
+	}
+
+	if engine.timeouts.Shutdown > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, engine.timeouts.Shutdown)
+		defer cancel()
+	}
+	err := engine.shutdownServers(shutdownCtx, servers)
+	if serveErr != nil {
+		return serveErr
+	}
+	return err
+}
+
+// shutdownServers 等待所有的 Server 处理完正在进行的请求，超时后强制关闭，然后执行关闭钩子
+func (engine *Engine) shutdownServers(ctx context.Context, servers []managedServer) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(servers))
+	for i, s := range servers {
+		wg.Add(1)
+		go func(i int, srv *http.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				errs[i] = err
+				srv.Close()
+			}
+		}(i, s.srv)
+	}
+	wg.Wait()
+
+	engine.state.mu.Lock()
+	onShutdown := append([]func(context.Context) error(nil), engine.state.onShutdown...)
+	engine.state.mu.Unlock()
+	for i := len(onShutdown) - 1; i >= 0; i-- {
+		if err := onShutdown[i](ctx); err != nil {
+			engine.logger.Error("shutdown hook failed", F("error", err))
+		}
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			engine.logger.Error("graceful shutdown failed, connections closed", F("error", err))
+			return err
+		}
+	}
+	engine.logger.Info("server stopped")
+	return nil
+}
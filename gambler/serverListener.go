@@ -0,0 +1,143 @@
+package gambler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// serverListener.go: 在 TCP 以外的 listener 上提供服务，eg: Unix domain socket、调用方创建的 listener、systemd 传入的 socket
+// 和 Run 一样支持优雅关闭和生命周期钩子
+
+// ErrNoSystemdListeners 没有从 systemd 获取到 socket，进程不是通过 socket activation 启动的
+var ErrNoSystemdListeners = errors.New("gambler: no listeners passed by systemd")
+
+// systemdFirstFD systemd 传入的第一个文件描述符，0、1、2 是标准输入输出
+const systemdFirstFD = 3
+
+// defaultUnixSocketMode Unix socket 文件的默认权限，同组的进程(eg: 反向代理 sidecar)可以连接
+const defaultUnixSocketMode os.FileMode = 0o660
+
+// SetUnixSocketMode 设置 RunUnix 创建的 socket 文件的权限，需要在 RunUnix 之前调用
+func (engine *Engine) SetUnixSocketMode(mode os.FileMode) {
+	engine.unixSocketMode = mode
+	engine.logger.Debug("unix socket mode set", F("mode", mode))
+}
+
+// RunListener 在调用方创建的 listener 上提供服务，eg: 测试时监听随机端口
+func (engine *Engine) RunListener(ln net.Listener) error {
+	return engine.serve(context.Background(), managedServer{srv: engine.newServer(ln.Addr().String()), ln: ln})
+}
+
+// RunUnix 监听 Unix domain socket，已经存在的 socket 文件没有进程在监听时会被删除，关闭后自动删除 socket 文件
+func (engine *Engine) RunUnix(path string) error {
+	ln, err := engine.listen("unix", path, func() (net.Listener, error) {
+		return listenUnix(path, engine.unixSocketMode)
+	})
+	if err != nil {
+		return err
+	}
+	return engine.RunListener(ln)
+}
+
+// listenUnix 监听 Unix socket 并设置文件权限
+// Unix 平台上 Listen 期间临时收紧 umask，socket 文件创建时就是 mode 的权限，不会有一段时间使用进程默认的 umask 被其他用户连接
+// 其他平台上创建后才 Chmod，需要限制访问时把 socket 放在只有当前用户可以访问的目录中
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("gambler: %s exists and is not a socket", path)
+		}
+		// 能连上说明还有进程在监听，不能删除
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("gambler: %s is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	restore := restrictUmask(mode)
+	ln, err := net.Listen("unix", path)
+	restore()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// RunSystemd 在 systemd socket activation 传入的所有 socket 上提供服务
+func (engine *Engine) RunSystemd() error {
+	// 平滑重启后 socket 是由父进程传入的
+	var listeners []net.Listener
+	for i := 0; ; i++ {
+		ln := engine.takeInherited("systemd://" + strconv.Itoa(i))
+		if ln == nil {
+			break
+		}
+		listeners = append(listeners, ln)
+	}
+	if len(listeners) == 0 {
+		var err error
+		if listeners, err = SystemdListeners(); err != nil {
+			return err
+		}
+	}
+	servers := make([]managedServer, 0, len(listeners))
+	for i, ln := range listeners {
+		engine.setListenerKey(ln, "systemd://"+strconv.Itoa(i))
+		servers = append(servers, managedServer{srv: engine.newServer(ln.Addr().String()), ln: ln})
+	}
+	return engine.serve(context.Background(), servers...)
+}
+
+// SystemdListeners 根据 LISTEN_PID 和 LISTEN_FDS 环境变量获取 systemd 传入的 socket，没有传入时返回 ErrNoSystemdListeners
+// 获取后会删除这些环境变量，避免子进程误用
+func SystemdListeners() ([]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	return systemdListeners(os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES"), systemdFirstFD)
+}
+
+// systemdListeners 把从 firstFD 开始的文件描述符转换成 listener
+func systemdListeners(pid string, fds string, names string, firstFD int) ([]net.Listener, error) {
+	// LISTEN_PID 不是当前进程说明环境变量是从父进程继承的，socket 不是传给当前进程的
+	if pid == "" || fds == "" || pid != strconv.Itoa(os.Getpid()) {
+		return nil, ErrNoSystemdListeners
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n <= 0 {
+		return nil, ErrNoSystemdListeners
+	}
+	fdNames := strings.Split(names, ":")
+	listeners := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(firstFD+i)
+		if i < len(fdNames) && fdNames[i] != "" {
+			name = fdNames[i]
+		}
+		file := os.NewFile(uintptr(firstFD+i), name)
+		// FileListener 会复制文件描述符，原来的需要关闭
+		ln, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("gambler: systemd socket %s: %w", name, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
@@ -0,0 +1,103 @@
+//go:build linux
+
+package gambler
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSystemdListeners(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	file, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// systemdListeners 会关闭传入的描述符，传一个复制的，避免 file 被回收时再关闭一次，关掉后来复用了这个编号的描述符
+	fd, err := syscall.Dup(int(file.Fd()))
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := systemdListeners("1", "1", "", fd); err != ErrNoSystemdListeners {
+		t.Fatalf("LISTEN_PID of another process should be ignored, got %v", err)
+	}
+	listeners, err := systemdListeners(strconv.Itoa(os.Getpid()), "1", "http", fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listeners) != 1 || listeners[0].Addr().String() != ln.Addr().String() {
+		t.Fatalf("unexpected listeners %v", listeners)
+	}
+
+	r := New()
+	r.GET("/", func(c *Context) {
+		c.String(http.StatusOK, "systemd")
+	})
+	started := waitStarted(r)
+	result := make(chan error, 1)
+	go func() {
+		result <- r.RunListener(listeners[0])
+	}()
+	<-started
+	client := &http.Client{Timeout: time.Second}
+	resp, err := client.Get("http://" + ln.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "systemd" {
+		t.Fatalf("unexpected body %s", body)
+	}
+	r.Shutdown(context.Background())
+	<-result
+}
+
+func TestListenUnixUmask(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gambler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// 进程的 umask 很宽松时，socket 创建时的权限也不能超过配置的权限
+	old := syscall.Umask(0)
+	defer syscall.Umask(old)
+	restore := restrictUmask(0o600)
+	if mask := syscall.Umask(0o077); mask != 0o177 {
+		t.Fatalf("umask should be 0177 while listening, got %#o", mask)
+	}
+	restore()
+	if mask := syscall.Umask(0); mask != 0 {
+		t.Fatalf("umask should be restored, got %#o", mask)
+	}
+
+	path := dir + "/gambler.sock"
+	ln, err := listenUnix(path, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("socket mode should be 0600, got %v", info.Mode().Perm())
+	}
+	if mask := syscall.Umask(0); mask != 0 {
+		t.Fatalf("umask should be restored after listen, got %#o", mask)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package gambler
+
+import "os"
+
+// restrictUmask 其他平台没有 umask，socket 文件的权限只能在创建后通过 Chmod 修改
+func restrictUmask(mode os.FileMode) (restore func()) {
+	return func() {}
+}
@@ -0,0 +1,91 @@
+package gambler
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// waitStarted 注册启动钩子，返回启动完成后会 close 的 channel
+func waitStarted(r *Engine) <-chan struct{} {
+	started := make(chan struct{})
+	r.OnStart(func(ctx context.Context) error {
+		close(started)
+		return nil
+	})
+	return started
+}
+
+func TestRunUnix(t *testing.T) {
+	// Unix socket 路径有长度限制，不使用 t.TempDir
+	dir, err := os.MkdirTemp("", "gambler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "gambler.sock")
+	// 上次异常退出留下的 socket 文件
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	r := New()
+	r.SetUnixSocketMode(0o600)
+	r.GET("/", func(c *Context) {
+		c.String(http.StatusOK, "unix")
+	})
+	started := waitStarted(r)
+	result := make(chan error, 1)
+	go func() {
+		result <- r.RunUnix(path)
+	}()
+	select {
+	case <-started:
+	case err := <-result:
+		t.Fatalf("RunUnix failed: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("socket mode should be 0600, got %v", info.Mode().Perm())
+	}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://unix/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "unix" {
+		t.Fatalf("unexpected body %s", body)
+	}
+
+	// 有进程在监听时不能删除 socket
+	if _, err := listenUnix(path, 0o600); err == nil {
+		t.Fatal("socket in use should not be removed")
+	}
+
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("socket file should be removed after shutdown")
+	}
+}
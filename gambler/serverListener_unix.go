@@ -0,0 +1,23 @@
+//go:build unix
+
+package gambler
+
+import (
+	"os"
+	"sync"
+	"syscall"
+)
+
+// umaskMu umask 是整个进程共享的，同时创建多个 socket 时需要串行修改
+var umaskMu sync.Mutex
+
+// restrictUmask 临时修改 umask，让 bind 创建的 socket 文件权限一开始就不超过 mode，返回恢复原来 umask 的函数
+// 修改期间其他 goroutine 创建的文件也会使用这个 umask，只会更严格，不会更宽松
+func restrictUmask(mode os.FileMode) (restore func()) {
+	umaskMu.Lock()
+	old := syscall.Umask(int(0o777 &^ mode.Perm()))
+	return func() {
+		syscall.Umask(old)
+		umaskMu.Unlock()
+	}
+}
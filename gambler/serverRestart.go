@@ -0,0 +1,241 @@
+package gambler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serverRestart.go: 平滑重启，升级二进制文件时不断开连接
+// 开启后收到 SIGUSR2 或 SIGHUP(只支持 Linux)时，用当前的命令行参数启动新的可执行文件，把正在监听的 socket 通过继承的文件描述符传给子进程
+// 子进程的 Run 系列方法按照相同的地址直接使用继承的 socket，启动完成后通过管道通知父进程，父进程再优雅关闭并从 Run 返回
+// 子进程启动失败时父进程继续提供服务
+//
+// 父进程通过环境变量告诉子进程：
+//   GAMBLER_LISTEN_FDS   继承的 socket 数量，从文件描述符 3 开始
+//   GAMBLER_LISTEN_KEYS  每个 socket 对应的地址，JSON 数组，eg: ["tcp://:9999","unix:///run/app.sock"]
+//   GAMBLER_READY_FD     启动完成后写入的管道
+
+const (
+	envListenFDs  = "GAMBLER_LISTEN_FDS"
+	envListenKeys = "GAMBLER_LISTEN_KEYS"
+	envReadyFD    = "GAMBLER_READY_FD"
+)
+
+// restartReadyTimeout 等待子进程启动完成的最长时间
+const restartReadyTimeout = time.Minute
+
+// EnableGracefulRestart 开启平滑重启，收到 SIGUSR2 或 SIGHUP 时启动新进程接管 socket，需要在 Run 之前调用
+// 重启成功后 Run 返回 nil，main 函数应该直接退出
+func (engine *Engine) EnableGracefulRestart() {
+	if len(restartSignals) == 0 {
+		engine.logger.Warn("graceful restart is not supported on this platform")
+		return
+	}
+	engine.state.mu.Lock()
+	engine.state.restart = true
+	engine.state.mu.Unlock()
+	engine.logger.Debug("graceful restart enabled")
+}
+
+// listen 优先使用父进程传入的同一个地址的 socket，没有时调用 create 创建，并记录 socket 对应的地址
+func (engine *Engine) listen(network string, addr string, create func() (net.Listener, error)) (net.Listener, error) {
+	key := network + "://" + addr
+	ln := engine.takeInherited(key)
+	if ln == nil {
+		var err error
+		if ln, err = create(); err != nil {
+			return nil, err
+		}
+	} else {
+		engine.logger.Info("using inherited listener", F("addr", key))
+	}
+	engine.setListenerKey(ln, key)
+	return ln, nil
+}
+
+// setListenerKey 记录 socket 对应的地址，重启时传给子进程
+func (engine *Engine) setListenerKey(ln net.Listener, key string) {
+	engine.state.mu.Lock()
+	defer engine.state.mu.Unlock()
+	if engine.state.listenerKeys == nil {
+		engine.state.listenerKeys = make(map[net.Listener]string)
+	}
+	engine.state.listenerKeys[ln] = key
+}
+
+// takeInherited 取出父进程传入的 socket，每个 socket 只能取一次
+func (engine *Engine) takeInherited(key string) net.Listener {
+	engine.state.inheritOnce.Do(engine.loadInherited)
+	engine.state.mu.Lock()
+	defer engine.state.mu.Unlock()
+	ln := engine.state.inherited[key]
+	delete(engine.state.inherited, key)
+	return ln
+}
+
+// loadInherited 根据环境变量加载父进程传入的 socket
+func (engine *Engine) loadInherited() {
+	fds, keys := os.Getenv(envListenFDs), os.Getenv(envListenKeys)
+	os.Unsetenv(envListenFDs)
+	os.Unsetenv(envListenKeys)
+	if fds == "" {
+		return
+	}
+	var names []string
+	n, err := strconv.Atoi(fds)
+	if err == nil {
+		err = json.Unmarshal([]byte(keys), &names)
+	}
+	if err != nil || n != len(names) {
+		engine.logger.Error("invalid inherited listeners", F(envListenFDs, fds), F(envListenKeys, keys))
+		return
+	}
+	inherited := make(map[string]net.Listener, n)
+	for i, name := range names {
+		file := os.NewFile(uintptr(systemdFirstFD+i), name)
+		ln, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			engine.logger.Error("invalid inherited listener", F("addr", name), F("error", err))
+			continue
+		}
+		// 子进程接管了 Unix socket 文件，退出时负责删除
+		if unixLn, ok := ln.(*net.UnixListener); ok {
+			unixLn.SetUnlinkOnClose(true)
+		}
+		inherited[name] = ln
+	}
+	engine.state.mu.Lock()
+	engine.state.inherited = inherited
+	engine.state.mu.Unlock()
+}
+
+// notifyReady 启动完成后通知父进程，关闭没有用到的继承的 socket，避免新的连接一直没有进程处理
+func (engine *Engine) notifyReady() {
+	engine.state.inheritOnce.Do(engine.loadInherited)
+	engine.state.mu.Lock()
+	for key, ln := range engine.state.inherited {
+		engine.logger.Warn("inherited listener not used, closed", F("addr", key))
+		ln.Close()
+		delete(engine.state.inherited, key)
+	}
+	engine.state.mu.Unlock()
+
+	value := os.Getenv(envReadyFD)
+	if value == "" {
+		return
+	}
+	os.Unsetenv(envReadyFD)
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return
+	}
+	ready := os.NewFile(uintptr(fd), "ready")
+	ready.Write([]byte{1})
+	ready.Close()
+}
+
+// restart 启动新的进程并把 servers 的 socket 传给它，等待新进程启动完成
+func (engine *Engine) restart(servers []managedServer) error {
+	keys := make([]string, 0, len(servers))
+	files := make([]*os.File, 0, len(servers)+1)
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	for _, s := range servers {
+		engine.state.mu.Lock()
+		key := engine.state.listenerKeys[s.ln]
+		engine.state.mu.Unlock()
+		filer, ok := s.ln.(interface{ File() (*os.File, error) })
+		if key == "" || !ok {
+			return fmt.Errorf("gambler: listener %s can not be passed to the new process", s.ln.Addr())
+		}
+		file, err := filer.File()
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		files = append(files, file)
+	}
+	encodedKeys, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	readyRead, readyWrite, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyRead.Close()
+	files = append(files, readyWrite)
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	// ExtraFiles 中的第 i 个文件在子进程中的文件描述符是 3+i
+	cmd.ExtraFiles = files
+	cmd.Env = append(restartEnv(),
+		envListenFDs+"="+strconv.Itoa(len(keys)),
+		envListenKeys+"="+string(encodedKeys),
+		envReadyFD+"="+strconv.Itoa(systemdFirstFD+len(keys)),
+	)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// 关闭父进程中管道的写入端，子进程退出时读取端才能收到 EOF
+	readyWrite.Close()
+	files = files[:len(files)-1]
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := readyRead.Read(make([]byte, 1))
+		ready <- err
+	}()
+	timer := time.NewTimer(restartReadyTimeout)
+	defer timer.Stop()
+	select {
+	case err = <-ready:
+		if err != nil {
+			err = errors.New("gambler: new process exited before ready")
+		}
+	case <-timer.C:
+		err = errors.New("gambler: new process not ready in time")
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	engine.logger.Info("new process ready", F("pid", cmd.Process.Pid))
+	// 子进程接管了 Unix socket 文件，父进程关闭时不能删除
+	for _, s := range servers {
+		if unixLn, ok := s.ln.(*net.UnixListener); ok {
+			unixLn.SetUnlinkOnClose(false)
+		}
+	}
+	cmd.Process.Release()
+	return nil
+}
+
+// restartEnv 去掉当前进程中平滑重启和 systemd 相关的环境变量
+func restartEnv() []string {
+	env := make([]string, 0, len(os.Environ()))
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, "GAMBLER_LISTEN_") || strings.HasPrefix(kv, envReadyFD+"=") || strings.HasPrefix(kv, "LISTEN_") {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return env
+}
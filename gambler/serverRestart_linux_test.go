@@ -0,0 +1,118 @@
+//go:build linux
+
+package gambler
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// envRestartTestChild 平滑重启测试中，子进程重新执行测试时用它区分自己是子进程
+const envRestartTestChild = "GAMBLER_TEST_RESTART_CHILD"
+
+// newRestartTestEngine slowStarted 不为空时，/slow 开始处理后通知测试
+func newRestartTestEngine(slowStarted chan<- struct{}) *Engine {
+	r := New()
+	r.SetLogger(nil)
+	r.EnableGracefulRestart()
+	r.GET("/pid", func(c *Context) {
+		c.String(http.StatusOK, "%d", os.Getpid())
+	})
+	r.GET("/slow", func(c *Context) {
+		if slowStarted != nil {
+			slowStarted <- struct{}{}
+		}
+		time.Sleep(200 * time.Millisecond)
+		c.String(http.StatusOK, "slow")
+	})
+	return r
+}
+
+func TestGracefulRestart(t *testing.T) {
+	if addr := os.Getenv(envRestartTestChild); addr != "" {
+		// 子进程：使用相同的地址启动，收到 SIGTERM 后退出
+		if err := newRestartTestEngine(nil).RunWithContext(context.Background(), addr); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	// 先拿到一个空闲端口，父子进程使用同一个地址
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := probe.Addr().String()
+	probe.Close()
+	t.Setenv(envRestartTestChild, addr)
+	// 子进程只执行这一个测试
+	args := os.Args
+	os.Args = []string{args[0], "-test.run=^TestGracefulRestart$"}
+	defer func() { os.Args = args }()
+
+	slowStarted := make(chan struct{}, 1)
+	r := newRestartTestEngine(slowStarted)
+	started := waitStarted(r)
+	result := make(chan error, 1)
+	go func() {
+		result <- r.RunWithContext(context.Background(), addr)
+	}()
+	select {
+	case <-started:
+	case err := <-result:
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}, Timeout: 5 * time.Second}
+	get := func(path string) string {
+		resp, err := client.Get("http://" + addr + path)
+		if err != nil {
+			t.Error(err)
+			return ""
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	if pid := get("/pid"); pid != strconv.Itoa(os.Getpid()) {
+		t.Fatalf("request should be served by the parent, got pid %s", pid)
+	}
+
+	slow := make(chan string, 1)
+	go func() {
+		slow <- get("/slow")
+	}()
+	// 等请求真正开始处理之后再重启，机器负载高时固定的等待时间不够
+	select {
+	case <-slowStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow request should reach the parent")
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("parent should exit cleanly after restart, got %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("parent should shut down after the new process is ready")
+	}
+	if body := <-slow; body != "slow" {
+		t.Fatalf("in-flight request should complete during restart, got %q", body)
+	}
+
+	childPid, err := strconv.Atoi(get("/pid"))
+	if err != nil || childPid == os.Getpid() {
+		t.Fatalf("request should be served by the new process, got pid %d %v", childPid, err)
+	}
+	syscall.Kill(childPid, syscall.SIGTERM)
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package gambler
+
+import "os"
+
+// restartSignals 其他平台不支持平滑重启
+var restartSignals []os.Signal
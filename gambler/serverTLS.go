@@ -0,0 +1,163 @@
+package gambler
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// serverTLS.go: HTTPS、HTTP/2 和 h2c
+// HTTPS 默认同时支持 HTTP/2 和 HTTP/1.1，由 TLS 握手时的 ALPN 协商决定；h2c 是不加密的 HTTP/2，只适合内部服务之间的通信
+// RunTLS 会定期检查证书文件，证书更新后新的连接自动使用新证书，不需要重启
+
+// certCheckInterval 检查证书文件是否更新的最小间隔
+const certCheckInterval = time.Second
+
+// EnableH2C 允许不加密的 HTTP/2(h2c)，客户端需要使用 HTTP/2 prior knowledge 的方式连接，需要在 Run 之前调用
+func (engine *Engine) EnableH2C() {
+	engine.h2c = true
+	engine.logger.Debug("h2c enabled")
+}
+
+// SetHTTPSRedirect RunTLS 时同时在 addr 上监听 HTTP，把所有请求重定向到 HTTPS，eg: SetHTTPSRedirect(":80")
+func (engine *Engine) SetHTTPSRedirect(addr string) {
+	engine.redirectAddr = addr
+	engine.logger.Debug("https redirect set", F("addr", addr))
+}
+
+// RunTLS 使用证书文件提供 HTTPS 服务，证书文件更新后自动重新加载
+func (engine *Engine) RunTLS(addr string, certFile string, keyFile string) error {
+	reloader, err := newCertReloader(certFile, keyFile, engine.logger)
+	if err != nil {
+		return err
+	}
+	return engine.RunTLSWithConfig(addr, &tls.Config{GetCertificate: reloader.GetCertificate})
+}
+
+// RunTLSWithConfig 使用自定义的 tls.Config 提供 HTTPS 服务，eg: 使用 GetCertificate 从证书管理服务获取证书
+func (engine *Engine) RunTLSWithConfig(addr string, config *tls.Config) error {
+	ln, err := engine.listen("tcp", addr, func() (net.Listener, error) {
+		return net.Listen("tcp", addr)
+	})
+	if err != nil {
+		return err
+	}
+	var redirectLn net.Listener
+	if engine.redirectAddr != "" {
+		redirectLn, err = engine.listen("tcp", engine.redirectAddr, func() (net.Listener, error) {
+			return net.Listen("tcp", engine.redirectAddr)
+		})
+		if err != nil {
+			ln.Close()
+			return err
+		}
+	}
+	return engine.serve(context.Background(), engine.tlsServers(ln, config, redirectLn)...)
+}
+
+// tlsServers 创建 HTTPS 的 Server，redirectLn 不为空时再创建一个重定向到 HTTPS 的 Server
+func (engine *Engine) tlsServers(ln net.Listener, config *tls.Config, redirectLn net.Listener) []managedServer {
+	config = config.Clone()
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	srv := engine.newServer(ln.Addr().String())
+	// ServeTLS 会在 NextProtos 中加上 h2 和 http/1.1，开启 HTTP/2
+	srv.TLSConfig = config
+	servers := []managedServer{{srv: srv, ln: ln, tls: true}}
+	if redirectLn != nil {
+		redirect := engine.newServer(redirectLn.Addr().String())
+		redirect.Handler = httpsRedirectHandler(ln.Addr().String())
+		servers = append(servers, managedServer{srv: redirect, ln: redirectLn})
+	}
+	return servers
+}
+
+// httpsRedirectHandler 把 HTTP 请求重定向到 tlsAddr 的端口上
+func httpsRedirectHandler(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host := stripPort(req.Host)
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		// GET 和 HEAD 以外的请求使用 308，浏览器重定向时不会改变请求方式和 body
+		code := http.StatusMovedPermanently
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			code = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), code)
+	})
+}
+
+// certReloader 在 TLS 握手时检查证书文件是否更新，更新后重新加载
+// 加载失败时(eg: 证书和私钥只更新了一个)继续使用旧的证书，下次检查时重试
+type certReloader struct {
+	certFile  string
+	keyFile   string
+	logger    Logger
+	interval  time.Duration // 检查文件的最小间隔
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	certMod   time.Time // 当前证书对应的文件修改时间
+	keyMod    time.Time
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile string, keyFile string, logger Logger) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger, interval: certCheckInterval}
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(certMod, keyMod); err != nil {
+		return nil, err
+	}
+	r.lastCheck = time.Now()
+	return r, nil
+}
+
+// GetCertificate 用于 tls.Config.GetCertificate
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now := time.Now(); now.Sub(r.lastCheck) >= r.interval {
+		r.lastCheck = now
+		certMod, keyMod, err := r.modTimes()
+		if err == nil && (!certMod.Equal(r.certMod) || !keyMod.Equal(r.keyMod)) {
+			err = r.load(certMod, keyMod)
+			if err == nil {
+				r.logger.Info("certificate reloaded", F("cert", r.certFile))
+			}
+		}
+		if err != nil {
+			r.logger.Error("certificate reload failed, keep using the old one", F("cert", r.certFile), F("error", err))
+		}
+	}
+	return r.cert, nil
+}
+
+func (r *certReloader) load(certMod time.Time, keyMod time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert, r.certMod, r.keyMod = &cert, certMod, keyMod
+	return nil
+}
+
+func (r *certReloader) modTimes() (certMod time.Time, keyMod time.Time, err error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
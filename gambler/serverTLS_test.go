@@ -0,0 +1,170 @@
+package gambler
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert 生成自签名证书，写到 dir 下的 cert.pem 和 key.pem
+func writeTestCert(t *testing.T, dir string, cn string) (certFile string, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// startTLSTestServer 启动 HTTPS 和重定向 Server，返回两个地址
+func startTLSTestServer(t *testing.T, r *Engine, config *tls.Config) (string, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirectLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	r.OnStart(func(ctx context.Context) error {
+		close(started)
+		return nil
+	})
+	result := make(chan error, 1)
+	go func() {
+		result <- r.serve(context.Background(), r.tlsServers(ln, config, redirectLn)...)
+	}()
+	<-started
+	t.Cleanup(func() {
+		r.Shutdown(context.Background())
+		<-result
+	})
+	return ln.Addr().String(), redirectLn.Addr().String()
+}
+
+func TestRunTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, "first")
+	reloader, err := newCertReloader(certFile, keyFile, nopLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloader.interval = 0
+	r := New()
+	r.GET("/", func(c *Context) {
+		c.String(http.StatusOK, "%s", c.Req.Proto)
+	})
+	addr, redirectAddr := startTLSTestServer(t, r, &tls.Config{GetCertificate: reloader.GetCertificate})
+
+	// 每次请求都建立新的连接，才能看到新的证书
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			ForceAttemptHTTP2: true,
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	get := func() *http.Response {
+		resp, err := client.Get("https://" + addr + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	resp := get()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("HTTPS should negotiate HTTP/2, got %s", resp.Proto)
+	}
+	if cn := resp.TLS.PeerCertificates[0].Subject.CommonName; cn != "first" {
+		t.Fatalf("unexpected certificate %s", cn)
+	}
+
+	writeTestCert(t, dir, "second")
+	// 文件系统的修改时间精度可能不够，手动设置一个不同的修改时间
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	os.Chtimes(keyFile, future, future)
+	if cn := get().TLS.PeerCertificates[0].Subject.CommonName; cn != "second" {
+		t.Fatalf("certificate should be reloaded, got %s", cn)
+	}
+
+	_, port, _ := net.SplitHostPort(addr)
+	resp, err = client.Get("http://" + redirectAddr + "/path?a=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "https://127.0.0.1:"+port+"/path?a=1" {
+		t.Fatalf("HTTP should redirect to HTTPS, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+}
+
+func TestH2C(t *testing.T) {
+	r := New()
+	r.EnableH2C()
+	r.GET("/", func(c *Context) {
+		c.String(http.StatusOK, "%s", c.Req.Proto)
+	})
+	base, _ := startTestServer(t, r, context.Background())
+	defer r.Shutdown(context.Background())
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	resp, err := client.Get(base + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("h2c request should use HTTP/2, got %s", resp.Proto)
+	}
+
+	// 仍然支持 HTTP/1.1
+	resp, err = http.Get(base + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 1 {
+		t.Fatalf("HTTP/1.1 should still work, got %s", resp.Proto)
+	}
+}
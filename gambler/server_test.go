@@ -0,0 +1,162 @@
+package gambler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestServerTimeouts(t *testing.T) {
+	r := New()
+	srv := r.newServer(":8080")
+	if srv.ReadHeaderTimeout != 10*time.Second || srv.IdleTimeout != 2*time.Minute || srv.WriteTimeout != 0 {
+		t.Fatalf("unexpected default timeouts: %+v", srv)
+	}
+	r.SetServerTimeouts(ServerTimeouts{ReadHeader: time.Second, Read: 2 * time.Second, Write: 3 * time.Second, Idle: 4 * time.Second})
+	srv = r.newServer(":8080")
+	if srv.ReadHeaderTimeout != time.Second || srv.ReadTimeout != 2*time.Second ||
+		srv.WriteTimeout != 3*time.Second || srv.IdleTimeout != 4*time.Second {
+		t.Fatalf("timeouts not applied: %+v", srv)
+	}
+}
+
+// startTestServer 在随机端口上启动 Engine，返回地址和 serve 的结果
+func startTestServer(t *testing.T, r *Engine, ctx context.Context) (string, <-chan error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	r.OnStart(func(ctx context.Context) error {
+		close(started)
+		return nil
+	})
+	result := make(chan error, 1)
+	go func() {
+		result <- r.serve(ctx, managedServer{srv: r.newServer(ln.Addr().String()), ln: ln})
+	}()
+	<-started
+	return "http://" + ln.Addr().String(), result
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	r := New()
+	entered, release := make(chan struct{}), make(chan struct{})
+	r.GET("/slow", func(c *Context) {
+		close(entered)
+		<-release
+		c.String(http.StatusOK, "done")
+	})
+	var hooks []string
+	r.OnShutdown(func(ctx context.Context) error {
+		hooks = append(hooks, "first")
+		return nil
+	})
+	r.OnShutdown(func(ctx context.Context) error {
+		hooks = append(hooks, "second")
+		return nil
+	})
+	base, result := startTestServer(t, r, context.Background())
+
+	type response struct {
+		body string
+		err  error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		resp, err := http.Get(base + "/slow")
+		if err != nil {
+			responses <- response{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- response{body: string(body), err: err}
+	}()
+	<-entered
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- r.Shutdown(context.Background())
+	}()
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown should wait for the in-flight request, returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+
+	if resp := <-responses; resp.err != nil || resp.body != "done" {
+		t.Fatalf("in-flight request should complete, got %q %v", resp.body, resp.err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if err := <-result; err != nil {
+		t.Fatalf("serve should return nil after graceful shutdown, got %v", err)
+	}
+	if strings.Join(hooks, ",") != "second,first" {
+		t.Fatalf("shutdown hooks should run in reverse order, got %v", hooks)
+	}
+	if _, err := http.Get(base + "/slow"); err == nil {
+		t.Fatal("server should not accept new connections after shutdown")
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	r := New()
+	r.SetServerTimeouts(ServerTimeouts{Shutdown: 50 * time.Millisecond})
+	entered, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	r.GET("/stuck", func(c *Context) {
+		close(entered)
+		<-release
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	base, result := startTestServer(t, r, ctx)
+	go http.Get(base + "/stuck")
+	<-entered
+	cancel()
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("serve should report the drain timeout, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("serve should force close after the shutdown timeout")
+	}
+}
+
+func TestShutdownOnSignal(t *testing.T) {
+	r := New()
+	_, result := startTestServer(t, r, context.Background())
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("serve should return nil on SIGTERM, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("serve should stop on SIGTERM")
+	}
+}
+
+func TestOnStartError(t *testing.T) {
+	r := New()
+	hookErr := errors.New("register failed")
+	r.OnStart(func(ctx context.Context) error {
+		return hookErr
+	})
+	if err := r.RunWithContext(context.Background(), "127.0.0.1:0"); err != hookErr {
+		t.Fatalf("OnStart error should stop Run, got %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package gambler
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// template.go: 模板的加载和热加载
+// debug 模式下每次渲染前检查模板文件是否有变化(新增、删除、修改)，有变化时重新解析，修改模板不需要重启服务
+// 重新解析时使用当前的 funcMap，解析失败时不会退出进程，而是在浏览器中显示错误，修复后刷新页面即可
+
+// errNoTemplates 渲染时还没有加载模板
+var errNoTemplates = errors.New("gambler: no templates loaded, call LoadHTMLGlob first")
+
+// htmlLoader 记录模板的来源，用于重新解析
+type htmlLoader struct {
+	mu        sync.Mutex
+	parse     func(root *template.Template) (*parsedTemplates, error) // 从空的 root 开始解析模板
+	signature func() (string, error)                                  // 模板文件的签名，签名变化说明文件有变化，为空时不支持热加载
+	watch     bool                                                    // 是否在渲染前检查文件变化
+	lastSig   string
+	err       error // 最近一次解析的错误
+}
+
+// parsedTemplates 解析好的模板
+type parsedTemplates struct {
+	root   *template.Template            // 所有模板都在一起，使用布局时只包含布局和公共模板
+	pages  map[string]*template.Template // 使用布局时每个页面单独的一组模板
+	layout string                        // 页面默认使用的布局
+}
+
+// templateSet 一组模板，base 从未执行过，需要请求级别的模板函数时从它 Clone；tmpl 是 base 的副本，用于渲染
+// Clone 出来的副本第一次执行时需要重新转义，代价很高，所以按照请求级别函数的名字缓存在 clones 中复用
+type templateSet struct {
+	base   *template.Template
+	tmpl   *template.Template
+	clones *sync.Map // 请求级别函数的名字(排序后用逗号连接) -> *sync.Pool
+}
+
+// newTemplateSet 创建一组模板，base 不能已经执行过
+func newTemplateSet(base *template.Template) *templateSet {
+	return &templateSet{base: base, tmpl: template.Must(base.Clone()), clones: &sync.Map{}}
+}
+
+// loadHTML 解析模板，debug 模式下开启热加载，解析失败时只记录错误，其他模式下解析失败直接 panic
+func (engine *Engine) loadHTML(loader *htmlLoader) {
+	loader.watch = IsDebugging() && loader.signature != nil
+	if loader.watch {
+		loader.lastSig, _ = loader.signature()
+	}
+	engine.htmlLoader = loader
+	parsed, err := loader.parse(template.New("").Funcs(engine.funcMap))
+	if err != nil {
+		if !loader.watch {
+			panic(err)
+		}
+		engine.logger.Error("parse templates failed", F("error", err))
+		loader.err = err
+		return
+	}
+	engine.setHTMLTemplates(parsed)
+	engine.logger.Debug("templates loaded", F("templates", len(parsed.root.Templates())), F("pages", len(parsed.pages)), F("watch", loader.watch))
+}
+
+// setHTMLTemplates 保存解析好的模板，已经执行过的模板不能 Clone，所以渲染使用的都是副本
+func (engine *Engine) setHTMLTemplates(parsed *parsedTemplates) {
+	engine.htmlSet = newTemplateSet(parsed.root)
+	engine.htmlTemplates = engine.htmlSet.tmpl
+	engine.htmlPages = nil
+	if parsed.pages != nil {
+		engine.htmlPages = make(map[string]*templateSet, len(parsed.pages))
+		for name, page := range parsed.pages {
+			engine.htmlPages[name] = newTemplateSet(page)
+		}
+	}
+	engine.htmlLayout = parsed.layout
+}
+
+// templates 返回渲染 page 使用的模板和默认布局，热加载时先检查文件是否有变化
+func (engine *Engine) templates(page string) (set templateSet, layout string, err error) {
+	loader := engine.htmlLoader
+	if loader != nil && loader.watch {
+		loader.mu.Lock()
+		defer loader.mu.Unlock()
+		if sig, err := loader.signature(); err == nil && sig != loader.lastSig {
+			loader.lastSig = sig
+			parsed, err := loader.parse(template.New("").Funcs(engine.funcMap))
+			if err != nil {
+				engine.logger.Error("reload templates failed", F("error", err))
+				loader.err = err
+			} else {
+				engine.setHTMLTemplates(parsed)
+				loader.err = nil
+				engine.logger.Debug("templates reloaded", F("templates", len(parsed.root.Templates())), F("pages", len(parsed.pages)))
+			}
+		}
+		if loader.err != nil {
+			return set, "", loader.err
+		}
+	}
+	if p, ok := engine.htmlPages[page]; ok {
+		return *p, engine.htmlLayout, nil
+	}
+	if engine.htmlTemplates == nil {
+		return set, "", errNoTemplates
+	}
+	return *engine.htmlSet, "", nil
+}
+
+// globSignature 根据 glob 匹配到的文件的路径、大小和修改时间生成签名
+func globSignature(pattern string) func() (string, error) {
+	return func() (string, error) {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return "", err
+		}
+		return filesSignature(files)
+	}
+}
+
+// fsSignature 根据 fs.FS 中匹配到的文件的路径、大小和修改时间生成签名
+func fsSignature(fsys fs.FS, patterns []string) func() (string, error) {
+	return func() (string, error) {
+		var b strings.Builder
+		for _, pattern := range patterns {
+			files, err := fs.Glob(fsys, pattern)
+			if err != nil {
+				return "", err
+			}
+			sort.Strings(files)
+			for _, file := range files {
+				info, err := fs.Stat(fsys, file)
+				if err != nil {
+					fmt.Fprintf(&b, "%s:missing;", file)
+					continue
+				}
+				fmt.Fprintf(&b, "%s:%d:%d;", file, info.Size(), info.ModTime().UnixNano())
+			}
+		}
+		return b.String(), nil
+	}
+}
+
+// filesSignature 根据文件的路径、大小和修改时间生成签名
+func filesSignature(files []string) (string, error) {
+	sort.Strings(files)
+	var b strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			// 文件被删除也是一种变化
+			fmt.Fprintf(&b, "%s:missing;", file)
+			continue
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String(), nil
+}
+
+// templateError 模板加载或者渲染失败时的响应，debug 模式下在浏览器中显示错误
+func (c *Context) templateError(err error) {
+	c.Logger().Error("render template failed", F("error", err))
+	if !IsDebugging() {
+		c.Fail(http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	c.Abort()
+	c.SetHeader("Content-Type", "text/html; charset=utf-8")
+	c.SetStatus(http.StatusInternalServerError)
+	fmt.Fprintf(c.Writer, "<!DOCTYPE html>\n<html><head><title>Template Error</title></head>"+
+		"<body><h1>Template Error</h1><pre>%s</pre></body></html>\n", template.HTMLEscapeString(err.Error()))
+}
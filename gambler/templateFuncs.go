@@ -0,0 +1,371 @@
+package gambler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// templateFuncs.go: 常用的模板函数，需要通过 AddFuncMap(FuncMap()) 注册，不会默认注册
+// 参数的顺序方便在管道中使用，被处理的值放在最后，eg: {{ .Title | truncate 20 }}、{{ .Name | default "匿名" }}
+//
+// 时间：formatDate、date、dateIn、timeAgo，eg: {{ .now | date "2006-01-02" }}、{{ .now | dateIn "UTC" "15:04" }}、{{ timeAgo .created }}
+// 数字：number(1234567 -> 1,234,567)、bytes(1536 -> 1.5 KB)
+// 字符串：truncate、title、slugify、default
+// 安全标记：safeHTML、safeURL、safeJS、safeCSS、safeAttr，只能用于可信的内容
+// 其他：json(在 <script> 中嵌入数据)、dict、list、add、sub、mul、div、mod
+
+// 模板函数的参数错误
+var (
+	errDictArgs  = errors.New("gambler: dict needs key and value pairs")
+	errDivByZero = errors.New("gambler: division by zero")
+)
+
+// FuncMapConfig 模板函数的配置
+type FuncMapConfig struct {
+	DateLayout string           // formatDate 使用的格式，默认 2006-01-02 15:04:05
+	Location   *time.Location   // 时间显示的时区，为空时使用本地时区
+	Now        func() time.Time // timeAgo 使用的当前时间，为空时使用 time.Now
+}
+
+// DefaultFuncMapConfig 返回默认的模板函数配置
+func DefaultFuncMapConfig() FuncMapConfig {
+	return FuncMapConfig{
+		DateLayout: "2006-01-02 15:04:05",
+		Location:   time.Local,
+		Now:        time.Now,
+	}
+}
+
+// FuncMap 使用默认配置的模板函数
+func FuncMap() template.FuncMap {
+	return FuncMapWithConfig(DefaultFuncMapConfig())
+}
+
+// FuncMapWithConfig 使用自定义配置的模板函数
+func FuncMapWithConfig(conf FuncMapConfig) template.FuncMap {
+	if conf.DateLayout == "" {
+		conf.DateLayout = "2006-01-02 15:04:05"
+	}
+	if conf.Location == nil {
+		conf.Location = time.Local
+	}
+	if conf.Now == nil {
+		conf.Now = time.Now
+	}
+	return template.FuncMap{
+		"formatDate": func(t interface{}) (string, error) {
+			return formatTime(t, conf.DateLayout, conf.Location)
+		},
+		"date": func(layout string, t interface{}) (string, error) {
+			return formatTime(t, layout, conf.Location)
+		},
+		"dateIn": func(zone string, layout string, t interface{}) (string, error) {
+			loc, err := time.LoadLocation(zone)
+			if err != nil {
+				return "", err
+			}
+			return formatTime(t, layout, loc)
+		},
+		"timeAgo": func(t interface{}) (string, error) {
+			tm, ok, err := toTime(t)
+			if err != nil || !ok {
+				return "", err
+			}
+			return relativeTime(tm, conf.Now()), nil
+		},
+		"number":   humanizeNumber,
+		"bytes":    humanizeBytes,
+		"truncate": truncate,
+		"title":    title,
+		"slugify":  slugify,
+		"default":  defaultValue,
+		"safeHTML": func(s string) template.HTML { return template.HTML(s) },
+		"safeURL":  func(s string) template.URL { return template.URL(s) },
+		"safeJS":   func(s string) template.JS { return template.JS(s) },
+		"safeCSS":  func(s string) template.CSS { return template.CSS(s) },
+		"safeAttr": func(s string) template.HTMLAttr { return template.HTMLAttr(s) },
+		"json":     toJSON,
+		"dict":     dict,
+		"list":     func(values ...interface{}) []interface{} { return values },
+		"add":      func(a, b interface{}) (interface{}, error) { return arith(a, b, '+') },
+		"sub":      func(a, b interface{}) (interface{}, error) { return arith(a, b, '-') },
+		"mul":      func(a, b interface{}) (interface{}, error) { return arith(a, b, '*') },
+		"div":      func(a, b interface{}) (interface{}, error) { return arith(a, b, '/') },
+		"mod":      func(a, b interface{}) (interface{}, error) { return arith(a, b, '%') },
+	}
+}
+
+// toTime 支持 time.Time、*time.Time 和 Unix 时间戳(秒)，nil 和零值返回 ok 为 false
+func toTime(v interface{}) (t time.Time, ok bool, err error) {
+	switch v := v.(type) {
+	case nil:
+		return t, false, nil
+	case time.Time:
+		t = v
+	case *time.Time:
+		if v == nil {
+			return t, false, nil
+		}
+		t = *v
+	case int:
+		t = time.Unix(int64(v), 0)
+	case int64:
+		t = time.Unix(v, 0)
+	default:
+		return t, false, fmt.Errorf("gambler: unsupported time value %T", v)
+	}
+	return t, !t.IsZero(), nil
+}
+
+// formatTime 在 loc 时区中按照 layout 格式化时间，空的时间输出空字符串
+func formatTime(v interface{}, layout string, loc *time.Location) (string, error) {
+	t, ok, err := toTime(v)
+	if err != nil || !ok {
+		return "", err
+	}
+	return t.In(loc).Format(layout), nil
+}
+
+// relativeTime 返回 t 相对于 now 的描述，eg: 3 minutes ago、in 2 days
+func relativeTime(t time.Time, now time.Time) string {
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+	if d < time.Minute {
+		return "just now"
+	}
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+	var s string
+	for _, u := range units {
+		if d >= u.size {
+			n := int64(d / u.size)
+			s = fmt.Sprintf("%d %s", n, u.name)
+			if n > 1 {
+				s += "s"
+			}
+			break
+		}
+	}
+	if future {
+		return "in " + s
+	}
+	return s + " ago"
+}
+
+// toNumber 把数字类型的值转换成 int64 或者 float64，isFloat 表示是否是浮点数
+func toNumber(v interface{}) (i int64, f float64, isFloat bool, err error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), float64(rv.Int()), false, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if u > math.MaxInt64 {
+			return 0, float64(u), true, nil
+		}
+		return int64(u), float64(u), false, nil
+	case reflect.Float32, reflect.Float64:
+		return 0, rv.Float(), true, nil
+	}
+	return 0, 0, false, fmt.Errorf("gambler: %T is not a number", v)
+}
+
+// humanizeNumber 给整数部分加上千位分隔符，浮点数保留两位小数，eg: 1234567.891 -> 1,234,567.89
+func humanizeNumber(v interface{}) (string, error) {
+	i, f, isFloat, err := toNumber(v)
+	if err != nil {
+		return "", err
+	}
+	s := strconv.FormatInt(i, 10)
+	if isFloat {
+		s = strconv.FormatFloat(f, 'f', 2, 64)
+	}
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	intPart, frac := s, ""
+	if dot := strings.IndexByte(s, '.'); dot >= 0 {
+		intPart, frac = s[:dot], s[dot:]
+	}
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteString(frac)
+	return b.String(), nil
+}
+
+// humanizeBytes 把字节数转换成 1024 进制的大小，eg: 1536 -> 1.5 KB
+func humanizeBytes(v interface{}) (string, error) {
+	_, f, _, err := toNumber(v)
+	if err != nil {
+		return "", err
+	}
+	if math.Abs(f) < 1024 {
+		return fmt.Sprintf("%d B", int64(f)), nil
+	}
+	units := []string{"KB", "MB", "GB", "TB", "PB", "EB"}
+	unit := ""
+	for _, u := range units {
+		f /= 1024
+		unit = u
+		if math.Abs(f) < 1024 {
+			break
+		}
+	}
+	s := strconv.FormatFloat(f, 'f', 1, 64)
+	return strings.TrimSuffix(s, ".0") + " " + unit, nil
+}
+
+// truncate 把字符串截断到 n 个字符(不是字节)，截断时末尾加上 …
+func truncate(n int, s string) string {
+	if n < 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n]) + "…"
+}
+
+// title 把每个单词的首字母大写
+func title(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(prev) {
+			prev = r
+			return unicode.ToTitle(r)
+		}
+		prev = r
+		return r
+	}, s)
+}
+
+// slugify 转换成 URL 中使用的形式，字母和数字转成小写，其他字符替换成 -，eg: Hello, World! -> hello-world
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
+
+// defaultValue v 是空值(nil、零值、空字符串、空的 slice 和 map)时返回 def
+func defaultValue(def interface{}, v interface{}) interface{} {
+	if v == nil {
+		return def
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		if rv.Len() == 0 {
+			return def
+		}
+	default:
+		if rv.IsZero() {
+			return def
+		}
+	}
+	return v
+}
+
+// toJSON 把数据编码成 JSON 嵌入到 <script> 中，<、>、& 会被转义，不会提前结束 script 标签
+func toJSON(v interface{}) (template.JS, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return template.JS(data), nil
+}
+
+// dict 使用 key、value 交替的参数构造 map，用于给子模板传递多个值，eg: {{ template "user.tmpl" dict "name" .Name "age" .Age }}
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errDictArgs
+	}
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("gambler: dict key %v is not a string", pairs[i])
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
+
+// arith 四则运算和取模，两个参数都是整数时结果是 int64，否则是 float64
+func arith(a, b interface{}, op byte) (interface{}, error) {
+	ai, af, aFloat, err := toNumber(a)
+	if err != nil {
+		return nil, err
+	}
+	bi, bf, bFloat, err := toNumber(b)
+	if err != nil {
+		return nil, err
+	}
+	if !aFloat && !bFloat {
+		switch op {
+		case '+':
+			return ai + bi, nil
+		case '-':
+			return ai - bi, nil
+		case '*':
+			return ai * bi, nil
+		}
+		if bi == 0 {
+			return nil, errDivByZero
+		}
+		if op == '/' {
+			return ai / bi, nil
+		}
+		return ai % bi, nil
+	}
+	switch op {
+	case '+':
+		return af + bf, nil
+	case '-':
+		return af - bf, nil
+	case '*':
+		return af * bf, nil
+	}
+	if bf == 0 {
+		return nil, errDivByZero
+	}
+	if op == '/' {
+		return af / bf, nil
+	}
+	return math.Mod(af, bf), nil
+}
@@ -0,0 +1,65 @@
+package gambler
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFuncMap(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	funcs := FuncMapWithConfig(FuncMapConfig{
+		Location: time.FixedZone("CST", 8*3600),
+		Now:      func() time.Time { return now },
+	})
+	data := map[string]interface{}{
+		"now":     now,
+		"before":  now.Add(-3 * time.Minute),
+		"after":   now.Add(49 * time.Hour),
+		"zero":    time.Time{},
+		"size":    int64(1536),
+		"title":   "hello, gambler web framework",
+		"empty":   "",
+		"html":    "<b>bold</b>",
+		"user":    map[string]interface{}{"name": "</script>", "age": 20},
+		"count":   7,
+		"average": 2.5,
+	}
+	cases := []struct {
+		tmpl string
+		want string
+	}{
+		{`{{ formatDate .now }}`, "2024-05-01 20:00:00"},
+		{`{{ .now | date "2006-01-02 15:04" }}`, "2024-05-01 20:00"},
+		{`{{ .now | dateIn "UTC" "15:04 MST" }}`, "12:00 UTC"},
+		{`{{ formatDate .zero }}`, ""},
+		{`{{ timeAgo .before }}|{{ timeAgo .after }}|{{ timeAgo .now }}`, "3 minutes ago|in 2 days|just now"},
+		{`{{ number 1234567 }} {{ number -1234.567 }} {{ number 12 }}`, "1,234,567 -1,234.57 12"},
+		{`{{ bytes .size }} {{ bytes 100 }} {{ bytes 1073741824 }}`, "1.5 KB 100 B 1 GB"},
+		{`{{ .title | truncate 5 }}|{{ .title | title }}|{{ .title | slugify }}`, "hello…|Hello, Gambler Web Framework|hello-gambler-web-framework"},
+		{`{{ .empty | default "anonymous" }} {{ .count | default 1 }}`, "anonymous 7"},
+		{`{{ .html }}{{ .html | safeHTML }}`, "&lt;b&gt;bold&lt;/b&gt;<b>bold</b>"},
+		{`<a href="{{ safeURL "javascript:void(0)" }}">`, `<a href="javascript:void%280%29">`},
+		{`<script>var user = {{ json .user }};</script>`, `<script>var user = {"age":20,"name":"\u003c/script\u003e"};</script>`},
+		{`{{ with dict "a" 1 "b" .count }}{{ .a }}-{{ .b }}{{ end }} {{ range list 1 2 3 }}{{ . }}{{ end }}`, "1-7 123"},
+		{`{{ add .count 3 }} {{ sub .count 10 }} {{ mul .count 2 }} {{ div .count 2 }} {{ mod .count 4 }} {{ mul .average 2 }}`, "10 -3 14 3 3 5"},
+	}
+	for _, tc := range cases {
+		tmpl := template.Must(template.New("").Funcs(funcs).Parse(tc.tmpl))
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			t.Fatalf("%s: %v", tc.tmpl, err)
+		}
+		if b.String() != tc.want {
+			t.Fatalf("%s: want %q, got %q", tc.tmpl, tc.want, b.String())
+		}
+	}
+
+	for _, bad := range []string{`{{ div 1 0 }}`, `{{ dict "a" }}`, `{{ dateIn "Nowhere/City" "15:04" .now }}`, `{{ add "a" 1 }}`} {
+		tmpl := template.Must(template.New("").Funcs(funcs).Parse(bad))
+		if err := tmpl.Execute(&strings.Builder{}, data); err == nil {
+			t.Fatalf("%s should fail", bad)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package gambler
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// templateLayout.go: 模板的布局(layout)、公共模板(partial)和 block 继承
+// 布局定义页面的骨架，在需要页面填充的地方使用 {{ block "content" . }}默认内容{{ end }}
+// 页面通过 {{ define "content" }}...{{ end }} 覆盖布局中的 block，公共模板(eg: 导航栏)通过 {{ template "nav.tmpl" . }} 引用
+// 每个页面和布局、公共模板单独组成一组模板，不同页面定义同名的 block 也不会冲突
+//
+// eg: templates/layouts/base.tmpl
+//   <html><head><title>{{ block "title" . }}gambler{{ end }}</title></head>
+//   <body>{{ template "nav.tmpl" . }}{{ block "content" . }}{{ end }}</body></html>
+// templates/pages/index.tmpl
+//   {{ define "title" }}首页{{ end }}
+//   {{ define "content" }}<p>hello {{ .Name }}</p>{{ end }}
+// 渲染：c.HTML(200, "index.tmpl", data) 使用默认布局，c.HTMLWithLayout(200, "base.tmpl", "index.tmpl", data) 指定布局
+
+// HTMLLayoutConfig 布局模板的配置，模板名是文件名，eg: base.tmpl
+type HTMLLayoutConfig struct {
+	FS            fs.FS  // 模板所在的文件系统，eg: go:embed 的 embed.FS，为空时从磁盘读取
+	Layouts       string // 布局文件的 glob，eg: templates/layouts/*.tmpl
+	Partials      string // 公共模板文件的 glob，所有页面和布局都可以引用，eg: templates/partials/*.tmpl
+	Pages         string // 页面文件的 glob，eg: templates/pages/*.tmpl
+	DefaultLayout string // c.HTML 默认使用的布局，为空时直接渲染页面
+}
+
+// LoadHTMLLayouts 按照布局加载模板，会替换之前加载的模板，debug 模式下模板文件有变化时自动重新加载
+// 页面以外的布局和公共模板也可以通过 c.HTML 直接渲染
+func (engine *Engine) LoadHTMLLayouts(conf HTMLLayoutConfig) {
+	if conf.Pages == "" {
+		panic("gambler: html layouts need Pages")
+	}
+	var patterns []string
+	for _, pattern := range []string{conf.Layouts, conf.Partials, conf.Pages} {
+		if pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	loader := &htmlLoader{
+		parse: func(root *template.Template) (*parsedTemplates, error) {
+			return parseLayouts(root, conf)
+		},
+	}
+	if conf.FS != nil {
+		loader.signature = fsSignature(conf.FS, patterns)
+	} else {
+		loader.signature = func() (string, error) {
+			var b strings.Builder
+			for _, pattern := range patterns {
+				sig, err := globSignature(pattern)()
+				if err != nil {
+					return "", err
+				}
+				b.WriteString(sig)
+			}
+			return b.String(), nil
+		}
+	}
+	engine.loadHTML(loader)
+}
+
+// parseLayouts 先解析布局和公共模板，每个页面在它们的副本上解析
+func parseLayouts(root *template.Template, conf HTMLLayoutConfig) (*parsedTemplates, error) {
+	glob := func(pattern string) ([]string, error) {
+		if pattern == "" {
+			return nil, nil
+		}
+		if conf.FS != nil {
+			return fs.Glob(conf.FS, pattern)
+		}
+		return filepath.Glob(pattern)
+	}
+	parse := func(t *template.Template, files []string) (*template.Template, error) {
+		if conf.FS != nil {
+			return t.ParseFS(conf.FS, files...)
+		}
+		return t.ParseFiles(files...)
+	}
+
+	for _, pattern := range []string{conf.Layouts, conf.Partials} {
+		files, err := glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			continue
+		}
+		if root, err = parse(root, files); err != nil {
+			return nil, err
+		}
+	}
+	if conf.DefaultLayout != "" && root.Lookup(conf.DefaultLayout) == nil {
+		return nil, fmt.Errorf("gambler: default layout %q not found", conf.DefaultLayout)
+	}
+
+	files, err := glob(conf.Pages)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("gambler: no pages match %q", conf.Pages)
+	}
+	pages := make(map[string]*template.Template, len(files))
+	for _, file := range files {
+		name := path.Base(filepath.ToSlash(file))
+		if _, ok := pages[name]; ok {
+			return nil, fmt.Errorf("gambler: duplicate page %q", name)
+		}
+		// 每个页面在布局的副本上解析，页面中的 define 只覆盖自己这一组模板
+		page, err := root.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if page, err = parse(page, []string{file}); err != nil {
+			return nil, err
+		}
+		pages[name] = page
+	}
+	return &parsedTemplates{root: root, pages: pages, layout: conf.DefaultLayout}, nil
+}
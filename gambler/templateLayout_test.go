@@ -0,0 +1,81 @@
+package gambler
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func newLayoutTestEngine() *Engine {
+	r := New()
+	r.SetFuncMap(template.FuncMap{"user": func() string { return "" }})
+	r.LoadHTMLLayouts(HTMLLayoutConfig{
+		FS: fstest.MapFS{
+			"layouts/base.tmpl":  {Data: []byte(`<title>{{ block "title" . }}gambler{{ end }}</title>{{ template "nav.tmpl" . }}{{ block "content" . }}{{ end }}`)},
+			"layouts/plain.tmpl": {Data: []byte(`[{{ block "content" . }}{{ end }}]`)},
+			"partials/nav.tmpl":  {Data: []byte(`<nav>{{ user }}</nav>`)},
+			"pages/index.tmpl":   {Data: []byte(`{{ define "title" }}Index{{ end }}{{ define "content" }}index {{ . }}{{ end }}`)},
+			"pages/about.tmpl":   {Data: []byte(`{{ define "content" }}about {{ . }}{{ end }}`)},
+		},
+		Layouts:       "layouts/*.tmpl",
+		Partials:      "partials/*.tmpl",
+		Pages:         "pages/*.tmpl",
+		DefaultLayout: "base.tmpl",
+	})
+	return r
+}
+
+func TestHTMLLayouts(t *testing.T) {
+	r := newLayoutTestEngine()
+	r.GET("/:page", func(c *Context) {
+		c.SetTemplateFunc("user", func() string { return "liup2" })
+		switch c.Query("layout") {
+		case "":
+			c.HTML(http.StatusOK, c.GetParam("page")+".tmpl", "data")
+		case "none":
+			c.HTMLWithLayout(http.StatusOK, "", c.GetParam("page")+".tmpl", "data")
+		default:
+			c.HTMLWithLayout(http.StatusOK, c.Query("layout"), c.GetParam("page")+".tmpl", "data")
+		}
+	})
+	cases := []struct {
+		url  string
+		want string
+	}{
+		{"/index", `<title>Index</title><nav>liup2</nav>index data`},
+		// 两个页面都定义了 content，互不影响；about 没有定义 title，使用布局中的默认值
+		{"/about", `<title>gambler</title><nav>liup2</nav>about data`},
+		{"/index?layout=plain.tmpl", `[index data]`},
+		{"/about?layout=none", ``},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", tc.url, nil))
+		if w.Code != http.StatusOK || w.Body.String() != tc.want {
+			t.Fatalf("%s: want %q, got %d %q", tc.url, tc.want, w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("missing page should fail, got %d", w.Code)
+	}
+}
+
+func TestHTMLLayoutsMissingDefault(t *testing.T) {
+	defer SetMode(Mode())
+	SetMode(ReleaseMode)
+	defer func() {
+		if recover() == nil {
+			t.Fatal("missing default layout should panic")
+		}
+	}()
+	New().LoadHTMLLayouts(HTMLLayoutConfig{
+		FS:            fstest.MapFS{"pages/index.tmpl": {Data: []byte(`index`)}},
+		Pages:         "pages/*.tmpl",
+		DefaultLayout: "base.tmpl",
+	})
+}
@@ -0,0 +1,148 @@
+package gambler
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// writeTemplate 写入模板文件，并把修改时间设置成不同的值，避免文件系统时间精度不够导致检测不到变化
+func writeTemplate(t *testing.T, file string, content string, modTime time.Time) {
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTemplateHotReload(t *testing.T) {
+	defer SetMode(Mode())
+	SetMode(DebugMode)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "page.tmpl")
+	now := time.Now()
+	writeTemplate(t, file, `{{ upper "v1" }}`, now)
+
+	r := New()
+	r.SetLogger(nil)
+	r.SetFuncMap(map[string]interface{}{"upper": strings.ToUpper})
+	r.LoadHTMLGlob(filepath.Join(dir, "*.tmpl"))
+	r.GET("/", func(c *Context) {
+		c.HTML(http.StatusOK, "page.tmpl", nil)
+	})
+	render := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return w
+	}
+	if body := render().Body.String(); body != "V1" {
+		t.Fatalf("unexpected body %q", body)
+	}
+
+	writeTemplate(t, file, `{{ upper "v2" }}`, now.Add(time.Second))
+	if body := render().Body.String(); body != "V2" {
+		t.Fatalf("template should be reloaded with the funcMap, got %q", body)
+	}
+
+	writeTemplate(t, file, `{{ upper "v3" `, now.Add(2*time.Second))
+	w := render()
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "Template Error") {
+		t.Fatalf("parse error should be shown in the browser, got %d %q", w.Code, w.Body.String())
+	}
+
+	writeTemplate(t, file, `{{ upper "v3" }}`, now.Add(3*time.Second))
+	if body := render().Body.String(); body != "V3" {
+		t.Fatalf("template should recover after the error is fixed, got %q", body)
+	}
+}
+
+func TestTemplateNoReloadInRelease(t *testing.T) {
+	defer SetMode(Mode())
+	SetMode(ReleaseMode)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "page.tmpl")
+	now := time.Now()
+	writeTemplate(t, file, `v1`, now)
+
+	r := New()
+	r.LoadHTMLGlob(filepath.Join(dir, "*.tmpl"))
+	r.GET("/", func(c *Context) {
+		c.HTML(http.StatusOK, "page.tmpl", nil)
+	})
+	writeTemplate(t, file, `v2`, now.Add(time.Second))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Body.String() != "v1" {
+		t.Fatalf("templates should not be reloaded in release mode, got %q", w.Body.String())
+	}
+
+	writeTemplate(t, file, `{{ broken `, now.Add(2*time.Second))
+	defer func() {
+		if recover() == nil {
+			t.Fatal("parse error should panic outside debug mode")
+		}
+	}()
+	r.LoadHTMLGlob(filepath.Join(dir, "*.tmpl"))
+}
+
+// renderPage 渲染 name 模板并返回响应
+func renderPage(r *Engine, name string) *httptest.ResponseRecorder {
+	r.GET("/"+name, func(c *Context) {
+		c.HTML(http.StatusOK, name, "gambler")
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/"+name, nil))
+	return w
+}
+
+func TestLoadHTMLFS(t *testing.T) {
+	r := New()
+	r.SetFuncMap(template.FuncMap{"upper": strings.ToUpper})
+	r.LoadHTMLFS(fstest.MapFS{
+		"templates/index.tmpl": {Data: []byte(`hello {{ upper . }}`)},
+		"templates/other.txt":  {Data: []byte(`ignored`)},
+	}, "templates/*.tmpl")
+	if body := renderPage(r, "index.tmpl").Body.String(); body != "hello GAMBLER" {
+		t.Fatalf("unexpected body %q", body)
+	}
+}
+
+func TestLoadHTMLFiles(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "index.tmpl")
+	writeTemplate(t, file, `hi {{ . }}`, time.Now())
+	r := New()
+	r.LoadHTMLFiles(file)
+	if body := renderPage(r, "index.tmpl").Body.String(); body != "hi gambler" {
+		t.Fatalf("unexpected body %q", body)
+	}
+}
+
+func TestSetHTMLTemplate(t *testing.T) {
+	r := New()
+	r.SetHTMLTemplate(template.Must(template.New("page").Parse(`page {{ . }}`)))
+	if body := renderPage(r, "page").Body.String(); body != "page gambler" {
+		t.Fatalf("unexpected body %q", body)
+	}
+}
+
+func TestSetFuncMapAndAddFuncMap(t *testing.T) {
+	r := New()
+	r.SetLogger(nil)
+	r.AddFuncMap(template.FuncMap{"upper": strings.ToUpper})
+	r.AddFuncMap(template.FuncMap{"lower": strings.ToLower})
+	if len(r.funcMap) != 2 {
+		t.Fatalf("AddFuncMap should merge, got %v", r.funcMap)
+	}
+	r.SetFuncMap(template.FuncMap{"title": strings.ToTitle})
+	if len(r.funcMap) != 1 || r.funcMap["title"] == nil {
+		t.Fatalf("SetFuncMap should replace, got %v", r.funcMap)
+	}
+}
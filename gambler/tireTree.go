@@ -2,7 +2,6 @@ package gambler
 
 import (
 	"fmt"
-	"log"
 	"strings"
 )
 
@@ -23,11 +22,9 @@ type node struct {
 func (n *node) matchChild(part string) *node {
 	for _, child := range n.children {
 		if child.part == part || child.isWild {
-			log.Printf("Debug msg : tireTree.go -> matchChild : part = %s, child = %v\n", part, child)
 			return child
 		}
 	}
-	log.Printf("Debug msg : tireTree.go -> matchChild : match child with part { %s } failed, do insert\n", part)
 	return nil
 }
 
@@ -40,17 +37,14 @@ func (n *node) matchChildren(part string) []*node {
 			nodes = append(nodes, child)
 		}
 	}
-	log.Printf("Debug msg : tireTree.go -> matchChildren : part = %s, nodes = %v\n", part, nodes)
 	return nodes
 }
 
 // insert 插入节点
 func (n *node) insert(pattern string, parts []string, height int) {
-	log.Printf("Debug msg : tireTree.go -> insert : pattern = %s, parts = %v, height = %v\n", pattern, parts, height)
 	if len(parts) == height {
 		// 遍历完了所有的part，那就把路径写到这个节点的pattern字段中
 		n.pattern = pattern
-		log.Printf("Debug msg : tireTree.go -> insert : insert node = %v FINISH\n", n)
 		return
 	}
 	//log.Printf("Debug msg : tireTree.go -> insert : parts = %v\n", parts)
@@ -58,7 +52,6 @@ func (n *node) insert(pattern string, parts []string, height int) {
 	child := n.matchChild(part)
 	if child == nil {
 		child = &node{part: part, isWild: part[0] == ':' || part[0] == '*'}
-		log.Printf("Debug msg : tireTree.go -> insert : child = %v", child)
 		n.children = append(n.children, child)
 	}
 	// 递归 height + 1
@@ -67,11 +60,9 @@ func (n *node) insert(pattern string, parts []string, height int) {
 
 // search 查找节点
 func (n *node) search(parts []string, height int) *node {
-	log.Printf("Debug msg : tireTree.go -> search : parts = %v\n", parts)
 	if len(parts) == height || strings.HasPrefix(n.part, "*") {
 		// 如果是只注册了 /hello/doc 这样的路径，那么当想访问 /hello 时，就会找不到 /hello 对应的节点，因为 /hello 路径对应节点的 pattern 为空
 		if n.pattern == "" {
-			log.Printf("Debug msg : tireTree.go -> search : node with part{ %s } found, but node pattern is null, NOT REGISTER\n", n.part)
 			return nil
 		}
 		return n
@@ -84,11 +75,9 @@ func (n *node) search(parts []string, height int) *node {
 		// 递归 height + 1
 		result := child.search(parts, height+1)
 		if result != nil {
-			log.Printf("Debug msg : tireTree.go -> search : result = %v\n", result)
 			return result
 		}
 	}
-	log.Printf("Debug msg : tireTree.go -> SEARCH FAILED \n")
 	return nil
 }
 
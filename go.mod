@@ -1,6 +1,6 @@
 module example
 
-go 1.18
+go 1.24
 
 require gambler v0.0.0
 
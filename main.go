@@ -27,29 +27,42 @@ import (
 
 //url: http://localhost:9999/date
 //url: http://localhost:9999/students
+//url: http://localhost:9999/debug/routes (debug 模式，Basic 认证 admin/admin)
+//url: http://localhost:9999/docs
 
 type student struct {
 	Name string
 	Age  int8
 }
 
+// loginForm /login 提交的表单，只用于生成 OpenAPI 文档
+type loginForm struct {
+	UserName string `form:"userName" description:"用户名"`
+	PassWord string `form:"passWord" description:"密码"`
+}
+
 func main() {
+	// 示例程序使用 debug 模式，输出框架的调试日志
+	gambler.SetMode(gambler.DebugMode)
 	r := gambler.New()
-	// 添加自定义的全局中间件 MiddlewareLogger 和 MiddlewareRecover
-	r.UseMiddlewares(gambler.MiddlewareLogger(), gambler.MiddlewareRecover())
+	// 添加自定义的全局中间件 MiddlewareLogger、MiddlewareRecover 和 MiddlewareRequestID
+	r.UseMiddlewares(gambler.MiddlewareLogger(), gambler.MiddlewareRecover(), gambler.MiddlewareRequestID())
 
 	// 测试recover中间件
 	r.GET("/panic", func(c *gambler.Context) {
 		names := []string{"liup2"}
-		c.String(http.StatusOK, names[10])
+		c.String(http.StatusOK, "%s", names[10])
 	})
 
-	//测试模板能否正常加载和渲染
-	r.SetFuncMap(template.FuncMap{
+	//测试模板能否正常加载和渲染，框架自带的模板函数需要显式注册
+	r.AddFuncMap(gambler.FuncMap())
+	r.AddFuncMap(r.URLFuncMap())
+	r.AddFuncMap(template.FuncMap{
 		"FormatAsDate": tools.FormatAsDate,
 	})
 	r.LoadHTMLGlob("templates/*")
-	r.Static("/assets", "./static")
+	// 命名的路由可以在模板中通过 {{ url "assets" "filepath" "css/IndexPage.css" }} 生成地址
+	r.Static("/assets", "./static").Name("assets")
 	studentA := &student{Name: "Liu", Age: 20}
 	studentB := &student{Name: "Zhou", Age: 18}
 	r.GET("/", func(c *gambler.Context) {
@@ -93,12 +106,25 @@ func main() {
 			"userName": c.PostForm("userName"),
 			"passWord": c.PostForm("passWord"),
 		})
-	})
+	}).Summary("登录").Tags("user").FormBody(loginForm{})
 
 	r.PUT("/put", func(c *gambler.Context) {
 		fmt.Fprintf(c.Writer, "Method: PUT")
 	})
 
+	// 查看所有注册的路由，?format=json 时返回 JSON，只在 debug 模式下挂载，并且需要 Basic 认证
+	if gambler.IsDebugging() {
+		debug := r.NewGroup("/debug")
+		debug.UseMiddlewares(gambler.MiddlewareBasicAuth(map[string]string{"admin": "admin"}))
+		debug.GET("/routes", r.RoutesHandler()).Hide()
+	}
+
+	// 根据注册的路由生成 OpenAPI 文档，/docs 是文档查看页面
+	openAPI := gambler.DefaultOpenAPIConfig()
+	openAPI.Title = "gambler example"
+	openAPI.UIPath = "/docs"
+	r.ServeOpenAPI(openAPI)
+
 	// 分组测试 g1
 	g1 := r.NewGroup("/g1")
 	// 测试只给 g1 分组添加中间件